@@ -2,41 +2,282 @@ package app
 
 import (
 	"context"
+	"encore.app/app/ledger"
+	"encore.dev/beta/errs"
 	"encore.dev/rlog"
 	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
 )
 
+const (
+	AccountTypeAsset     = "asset"
+	AccountTypeLiability = "liability"
+	AccountTypeRevenue   = "revenue"
+	AccountTypeExpense   = "expense"
+)
+
+// accountTypeCodes are the ledger codes of the account types, used unless a
+// code is given.
+var accountTypeCodes = map[string]uint16{
+	AccountTypeAsset:     1,
+	AccountTypeLiability: 2,
+	AccountTypeRevenue:   3,
+	AccountTypeExpense:   4,
+}
+
+type AccountParams struct {
+	IdempotencyKey string `header:"Idempotency-Key"`
+	AccountDetails
+}
+
+// AccountDetails describe an account to create.
+type AccountDetails struct {
+	// Type is "asset", "liability", "revenue" or "expense". Defaults to
+	// "liability", the type of customer accounts.
+	Type string
+	// Currency is the ISO 4217 code of the account's currency, which sets the
+	// ledger the account is on. Transfers can only move funds between accounts
+	// on the same ledger. Defaults to the currency of Ledger if it is set, or
+	// to the default currency.
+	Currency string
+	Ledger   uint32
+	// Code classifies the account in the ledger. Defaults to a code for Type.
+	Code uint16
+	// DebitsMustNotExceedCredits keeps the account from being overdrawn, and
+	// defaults to true for liability accounts. CreditsMustNotExceedDebits is
+	// its counterpart for debit balances.
+	DebitsMustNotExceedCredits *bool
+	CreditsMustNotExceedDebits *bool
+	// ExternalId, an ID in any format accepted for account IDs, is stored in
+	// the ledger as the account's user data. Defaults to the account ID.
+	ExternalId string
+	// ExternalReferences, Name, Owner and Tags are kept with the account's
+	// metadata, outside the ledger.
+	ExternalReferences map[string]string
+	Name               string
+	Owner              string
+	Tags               []string
+}
+
 type AccountResponse struct {
-	AccountId string
-	Amount    uint64
+	AccountId                  string
+	Amount                     uint64
+	Currency                   string
+	Type                       string
+	Ledger                     uint32
+	Code                       uint16
+	DebitsMustNotExceedCredits bool
+	CreditsMustNotExceedDebits bool
+	ExternalId                 string
+	ExternalReferences         map[string]string
+	Name                       string
+	Owner                      string
+	Tags                       []string
 }
 
 //encore:api public method=POST path=/account/:accountId
-func (s *Service) Account(ctx context.Context, accountId string) (*AccountResponse, error) {
-	accountIdCasted, _ := tbtypes.HexStringToUint128(accountId)
-	account := tbtypes.Account{
-		ID:             accountIdCasted,
-		Ledger:         LedgerId,
-		Code:           LedgerId,
-		UserData:       accountIdCasted,
-		Reserved:       [48]uint8{},
-		Flags:          tbtypes.AccountFlags{}.ToUint16(),
-		DebitsPending:  0,
-		DebitsPosted:   0,
-		CreditsPending: 0,
-		CreditsPosted:  0,
-		Timestamp:      0,
-	}
-	res, err := s.tbClient.CreateAccounts([]tbtypes.Account{account})
+func (s *Service) Account(ctx context.Context, accountId string, params *AccountParams) (*AccountResponse, error) {
+	request := []interface{}{"account", accountId, params}
+	return idempotent(ctx, s.idempotencyKeys, params.IdempotencyKey, request, func(string) (*AccountResponse, error) {
+		return s.createAccount(ctx, accountId, params)
+	})
+}
+
+func (s *Service) createAccount(ctx context.Context, accountId string, params *AccountParams) (*AccountResponse, error) {
+	accountIdCasted, err := parseId("accountId", accountId)
+	if err != nil {
+		return nil, err
+	}
+	account, metadata, err := s.newAccount(accountIdCasted, params.AccountDetails)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.ledger.CreateAccounts([]tbtypes.Account{account})
 	if err != nil {
 		rlog.Error("failed to create account", "error", err)
 		return nil, err
 	}
-	for _, r := range res {
-		rlog.Info("result " + r.Result.String())
+	if len(res) > 0 && res[0].Result != tbtypes.AccountExists {
+		rlog.Info("account not created", "result", res[0].Result.String())
+		return nil, ledger.AccountError(res[0].Result)
+	}
+	if len(res) > 0 {
+		matches, err := s.existingAccountMatches(account)
+		if err != nil {
+			return nil, err
+		}
+		if !matches {
+			rlog.Info("account not created", "result", res[0].Result.String())
+			return nil, ledger.AccountError(res[0].Result)
+		}
+	}
+
+	stored, err := storeAccountMetadata(ctx, metadata)
+	if err != nil {
+		rlog.Error("failed to store account metadata", "error", err)
+		return nil, err
+	}
+	// An existing account is only taken as created if it has no metadata yet,
+	// because an earlier attempt did not get to store it.
+	if len(res) > 0 && !stored {
+		rlog.Info("account not created", "result", res[0].Result.String())
+		return nil, ledger.AccountError(res[0].Result)
 	}
 	return &AccountResponse{
-		AccountId: accountId,
-		Amount:    0,
+		AccountId:                  accountIdCasted.String(),
+		Amount:                     0,
+		Currency:                   s.ledgerCurrency(metadata.Ledger).Code,
+		Type:                       metadata.Type,
+		Ledger:                     metadata.Ledger,
+		Code:                       metadata.Code,
+		DebitsMustNotExceedCredits: metadata.DebitsMustNotExceedCredits,
+		CreditsMustNotExceedDebits: metadata.CreditsMustNotExceedDebits,
+		ExternalId:                 account.UserData.String(),
+		ExternalReferences:         metadata.ExternalReferences,
+		Name:                       metadata.Name,
+		Owner:                      metadata.Owner,
+		Tags:                       metadata.Tags,
 	}, nil
 }
+
+// existingAccountMatches reports whether the account in the ledger with the ID
+// of account has its ledger, code, flags and user data, as one created by an
+// earlier attempt to create it does.
+func (s *Service) existingAccountMatches(account tbtypes.Account) (bool, error) {
+	existing, err := s.ledger.LookupAccounts([]tbtypes.Uint128{account.ID})
+	if err != nil {
+		rlog.Error("failed to fetch accounts", "error", err)
+		return false, err
+	}
+	return len(existing) == 1 &&
+		existing[0].Ledger == account.Ledger &&
+		existing[0].Code == account.Code &&
+		existing[0].Flags == account.Flags &&
+		existing[0].UserData == account.UserData, nil
+}
+
+// newAccount is the ledger account for details, with the defaults for its type
+// applied, and the metadata stored alongside it.
+func (s *Service) newAccount(accountId tbtypes.Uint128, details AccountDetails) (tbtypes.Account, AccountMetadata, error) {
+	metadata, err := s.newAccountMetadata(accountId, details)
+	if err != nil {
+		return tbtypes.Account{}, AccountMetadata{}, err
+	}
+	userData := accountId
+	if details.ExternalId != "" {
+		userData, err = parseId("ExternalId", details.ExternalId)
+		if err != nil {
+			return tbtypes.Account{}, AccountMetadata{}, err
+		}
+	}
+	account := tbtypes.Account{
+		ID:       accountId,
+		Ledger:   metadata.Ledger,
+		Code:     metadata.Code,
+		UserData: userData,
+		Flags: tbtypes.AccountFlags{
+			DebitsMustNotExceedCredits: metadata.DebitsMustNotExceedCredits,
+			CreditsMustNotExceedDebits: metadata.CreditsMustNotExceedDebits,
+		}.ToUint16(),
+	}
+	return account, metadata, nil
+}
+
+func (s *Service) newAccountMetadata(accountId tbtypes.Uint128, details AccountDetails) (AccountMetadata, error) {
+	metadata := AccountMetadata{
+		AccountId:          accountId,
+		Type:               details.Type,
+		Ledger:             details.Ledger,
+		Code:               details.Code,
+		ExternalReferences: details.ExternalReferences,
+		Name:               details.Name,
+		Owner:              details.Owner,
+		Tags:               details.Tags,
+	}
+	if metadata.Type == "" {
+		metadata.Type = AccountTypeLiability
+	}
+	typeCode, ok := accountTypeCodes[metadata.Type]
+	if !ok {
+		return AccountMetadata{}, &errs.Error{Code: errs.InvalidArgument, Message: "Type must be asset, liability, revenue or expense"}
+	}
+	switch {
+	case details.Currency != "":
+		currency, err := s.lookupCurrency("Currency", details.Currency)
+		if err != nil {
+			return AccountMetadata{}, err
+		}
+		if metadata.Ledger != 0 && metadata.Ledger != currency.Ledger {
+			return AccountMetadata{}, &errs.Error{Code: errs.InvalidArgument, Message: "Ledger must be the ledger of Currency"}
+		}
+		metadata.Ledger = currency.Ledger
+	case metadata.Ledger == 0:
+		metadata.Ledger = s.currencies.Default.Ledger
+	default:
+		if _, ok := s.currencies.ForLedger(metadata.Ledger); !ok {
+			return AccountMetadata{}, &errs.Error{Code: errs.InvalidArgument, Message: "Ledger must be the ledger of a supported currency"}
+		}
+	}
+	if metadata.Code == 0 {
+		metadata.Code = typeCode
+	}
+	if details.CreditsMustNotExceedDebits != nil {
+		metadata.CreditsMustNotExceedDebits = *details.CreditsMustNotExceedDebits
+	}
+	metadata.DebitsMustNotExceedCredits = metadata.Type == AccountTypeLiability && !metadata.CreditsMustNotExceedDebits
+	if details.DebitsMustNotExceedCredits != nil {
+		metadata.DebitsMustNotExceedCredits = *details.DebitsMustNotExceedCredits
+	}
+	if metadata.ExternalReferences == nil {
+		metadata.ExternalReferences = map[string]string{}
+	}
+	if metadata.Tags == nil {
+		metadata.Tags = []string{}
+	}
+	return metadata, nil
+}
+
+//encore:api public method=GET path=/account/:accountId
+func (s *Service) GetAccount(ctx context.Context, accountId string) (*AccountResponse, error) {
+	accountIdCasted, err := parseId("accountId", accountId)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := s.ledger.LookupAccounts([]tbtypes.Uint128{accountIdCasted})
+	if err != nil {
+		rlog.Error("failed to fetch accounts", "error", err)
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, &errs.Error{Code: errs.NotFound, Message: "account not found"}
+	}
+	account := accounts[0]
+	debitsFlag := tbtypes.AccountFlags{DebitsMustNotExceedCredits: true}.ToUint16()
+	creditsFlag := tbtypes.AccountFlags{CreditsMustNotExceedDebits: true}.ToUint16()
+	response := &AccountResponse{
+		AccountId:                  account.ID.String(),
+		Currency:                   s.ledgerCurrency(account.Ledger).Code,
+		Ledger:                     account.Ledger,
+		Code:                       account.Code,
+		DebitsMustNotExceedCredits: account.Flags&debitsFlag != 0,
+		CreditsMustNotExceedDebits: account.Flags&creditsFlag != 0,
+		ExternalId:                 account.UserData.String(),
+	}
+	if account.CreditsPosted > account.DebitsPosted {
+		response.Amount = account.CreditsPosted - account.DebitsPosted
+	}
+
+	// Accounts created before metadata was kept have none.
+	metadata, found, err := lookupAccountMetadata(ctx, accountIdCasted)
+	if err != nil {
+		rlog.Error("failed to fetch account metadata", "error", err)
+		return nil, err
+	}
+	if found {
+		response.Type = metadata.Type
+		response.ExternalReferences = metadata.ExternalReferences
+		response.Name = metadata.Name
+		response.Owner = metadata.Owner
+		response.Tags = metadata.Tags
+	}
+	return response, nil
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"encore.dev/storage/sqldb"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+)
+
+// AccountMetadata describes an account beyond what the ledger stores. It is
+// kept in the service's Postgres database, see app/migrations.
+type AccountMetadata struct {
+	AccountId                  tbtypes.Uint128
+	Type                       string
+	Ledger                     uint32
+	Code                       uint16
+	DebitsMustNotExceedCredits bool
+	CreditsMustNotExceedDebits bool
+	ExternalReferences         map[string]string
+	Name                       string
+	Owner                      string
+	Tags                       []string
+}
+
+// storeAccountMetadata stores the metadata of a new account, unless the account
+// already has metadata, which is left as it is. It reports whether it stored
+// the metadata.
+func storeAccountMetadata(ctx context.Context, metadata AccountMetadata) (bool, error) {
+	references, err := json.Marshal(metadata.ExternalReferences)
+	if err != nil {
+		return false, err
+	}
+	tags, err := json.Marshal(metadata.Tags)
+	if err != nil {
+		return false, err
+	}
+	res, err := sqldb.Exec(ctx, `
+		INSERT INTO accounts (account_id, type, ledger, code, debits_must_not_exceed_credits,
+			credits_must_not_exceed_debits, external_references, name, owner, tags)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (account_id) DO NOTHING
+	`, metadata.AccountId.String(), metadata.Type, int64(metadata.Ledger), int(metadata.Code),
+		metadata.DebitsMustNotExceedCredits, metadata.CreditsMustNotExceedDebits,
+		string(references), metadata.Name, metadata.Owner, string(tags))
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+// lookupAccountMetadata returns the metadata of an account, and false for
+// accounts created without any.
+func lookupAccountMetadata(ctx context.Context, accountId tbtypes.Uint128) (AccountMetadata, bool, error) {
+	metadata := AccountMetadata{AccountId: accountId}
+	var ledger int64
+	var code int
+	var references, tags string
+	err := sqldb.QueryRow(ctx, `
+		SELECT type, ledger, code, debits_must_not_exceed_credits, credits_must_not_exceed_debits,
+			external_references::text, name, owner, tags::text
+		FROM accounts
+		WHERE account_id = $1
+	`, accountId.String()).Scan(&metadata.Type, &ledger, &code, &metadata.DebitsMustNotExceedCredits,
+		&metadata.CreditsMustNotExceedDebits, &references, &metadata.Name, &metadata.Owner, &tags)
+	if err == sqldb.ErrNoRows {
+		return AccountMetadata{}, false, nil
+	}
+	if err != nil {
+		return AccountMetadata{}, false, err
+	}
+	metadata.Ledger = uint32(ledger)
+	metadata.Code = uint16(code)
+	err = json.Unmarshal([]byte(references), &metadata.ExternalReferences)
+	if err != nil {
+		return AccountMetadata{}, false, err
+	}
+	err = json.Unmarshal([]byte(tags), &metadata.Tags)
+	if err != nil {
+		return AccountMetadata{}, false, err
+	}
+	return metadata, true, nil
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"encore.app/app/ledger"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"fmt"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTransfersLimit = 100
+	maxTransfersLimit     = 1000
+)
+
+type AccountTransfersParams struct {
+	// Direction is "debit" or "credit" for only the transfers debiting or
+	// crediting the account, or empty for both.
+	Direction string
+	// From and To, RFC 3339 times, bound when the transfers were created.
+	// From is inclusive and To exclusive.
+	From string
+	To   string
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+	// Limit is the number of transfers in a page, 100 by default and at most
+	// 1000.
+	Limit int
+}
+
+type AccountTransfersResponse struct {
+	// Transfers are the transfers of the account, most recent first.
+	Transfers []*TransferDetails
+	// NextCursor fetches the next page, and is empty on the last page.
+	NextCursor string
+}
+
+// AccountTransfers lists the transfers debiting or crediting an account. Only
+// transfers created through the service are listed, from the journal.
+//
+//encore:api public method=GET path=/account/:accountId/transfers
+func (s *Service) AccountTransfers(ctx context.Context, accountId string, params *AccountTransfersParams) (*AccountTransfersResponse, error) {
+	accountIdCasted, err := parseId("accountId", accountId)
+	if err != nil {
+		return nil, err
+	}
+	query := ledger.TransferQuery{AccountId: accountIdCasted, Direction: params.Direction, Limit: params.Limit}
+	if query.Direction != "" && query.Direction != ledger.DirectionDebit && query.Direction != ledger.DirectionCredit {
+		return nil, &errs.Error{Code: errs.InvalidArgument, Message: "Direction must be debit or credit"}
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultTransfersLimit
+	}
+	if query.Limit < 0 || query.Limit > maxTransfersLimit {
+		return nil, &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("Limit must be between 1 and %d", maxTransfersLimit)}
+	}
+	query.From, err = parseTimestamp("From", params.From)
+	if err != nil {
+		return nil, err
+	}
+	query.To, err = parseTimestamp("To", params.To)
+	if err != nil {
+		return nil, err
+	}
+	if params.Cursor != "" {
+		query.BeforeTimestamp, query.BeforeId, err = parseCursor(params.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query.Before = true
+	}
+
+	accounts, err := s.ledger.LookupAccounts([]tbtypes.Uint128{accountIdCasted})
+	if err != nil {
+		rlog.Error("failed to fetch accounts", "error", err)
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, &errs.Error{Code: errs.NotFound, Message: "account not found"}
+	}
+
+	// One more transfer than the page tells whether there is a next page.
+	limit := query.Limit
+	query.Limit++
+	entries, err := s.journal.ListTransfers(ctx, query)
+	if err != nil {
+		rlog.Error("failed to list transfers", "error", err)
+		return nil, err
+	}
+	response := &AccountTransfersResponse{Transfers: []*TransferDetails{}}
+	for i, entry := range entries {
+		if i == limit {
+			last := entries[i-1].Transfer
+			response.NextCursor = newCursor(last.Timestamp, last.ID)
+			break
+		}
+		response.Transfers = append(response.Transfers, s.newTransferDetails(entry.Transfer, entry.Resolution))
+	}
+	return response, nil
+}
+
+// parseTimestamp parses an RFC 3339 time into a ledger timestamp, 0 if empty.
+func parseTimestamp(name string, value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || t.UnixNano() <= 0 {
+		return 0, &errs.Error{Code: errs.InvalidArgument, Message: name + " must be an RFC 3339 time"}
+	}
+	return uint64(t.UnixNano()), nil
+}
+
+// newCursor is a cursor to the transfers before the one with timestamp and
+// transferId.
+func newCursor(timestamp uint64, transferId tbtypes.Uint128) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", timestamp, transferId.String())))
+}
+
+func parseCursor(cursor string) (uint64, tbtypes.Uint128, error) {
+	invalid := &errs.Error{Code: errs.InvalidArgument, Message: "Cursor is invalid"}
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, tbtypes.Uint128{}, invalid
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return 0, tbtypes.Uint128{}, invalid
+	}
+	timestamp, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, tbtypes.Uint128{}, invalid
+	}
+	transferId, err := ledger.ParseId(parts[1])
+	if err != nil {
+		return 0, tbtypes.Uint128{}, invalid
+	}
+	return timestamp, transferId, nil
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"encore.app/app/ledger"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"fmt"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+)
+
+type AccountsBatchParams struct {
+	IdempotencyKey string `header:"Idempotency-Key"`
+
+	// Accounts to create, at most ledger.MaxBatchSize.
+	Accounts []BatchAccount
+	// Linked creates all of the accounts or none of them.
+	Linked bool
+}
+
+type BatchAccount struct {
+	AccountId string
+	AccountDetails
+}
+
+type AccountsBatchResponse struct {
+	// Results has a result for each account, in the order they were given.
+	Results []BatchAccountResult
+}
+
+type BatchAccountResult struct {
+	AccountId string
+	Created   bool
+	// Error is the error code and Reason the ledger result for accounts that
+	// were not created, see ledger.AccountError.
+	Error  string
+	Reason string
+}
+
+//encore:api public method=POST path=/accounts/batch
+func (s *Service) AccountsBatch(ctx context.Context, params *AccountsBatchParams) (*AccountsBatchResponse, error) {
+	request := []interface{}{"accounts-batch", params}
+	return idempotent(ctx, s.idempotencyKeys, params.IdempotencyKey, request, func(string) (*AccountsBatchResponse, error) {
+		return s.createAccountsBatch(ctx, params)
+	})
+}
+
+func (s *Service) createAccountsBatch(ctx context.Context, params *AccountsBatchParams) (*AccountsBatchResponse, error) {
+	if len(params.Accounts) == 0 || len(params.Accounts) > ledger.MaxBatchSize {
+		return nil, &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("Accounts must have between 1 and %d accounts", ledger.MaxBatchSize)}
+	}
+
+	accounts := make([]tbtypes.Account, len(params.Accounts))
+	metadata := make([]AccountMetadata, len(params.Accounts))
+	for i, batchAccount := range params.Accounts {
+		accountId, err := parseId(fmt.Sprintf("Accounts[%d].AccountId", i), batchAccount.AccountId)
+		if err != nil {
+			return nil, err
+		}
+		accounts[i], metadata[i], err = s.newAccount(accountId, batchAccount.AccountDetails)
+		if err != nil {
+			return nil, errs.Wrap(err, fmt.Sprintf("Accounts[%d]", i))
+		}
+		if params.Linked && i < len(params.Accounts)-1 {
+			accounts[i].Flags |= tbtypes.AccountFlags{Linked: true}.ToUint16()
+		}
+	}
+
+	res, err := s.ledger.CreateAccounts(accounts)
+	if err != nil {
+		rlog.Error("failed to create accounts", "error", err)
+		return nil, err
+	}
+	failures := map[uint32]tbtypes.CreateAccountResult{}
+	for _, r := range res {
+		failures[r.Index] = r.Result
+	}
+
+	response := &AccountsBatchResponse{Results: make([]BatchAccountResult, len(accounts))}
+	for i, account := range accounts {
+		result := BatchAccountResult{AccountId: account.ID.String(), Created: true}
+		// Metadata is only stored for accounts the ledger created. Existing
+		// accounts are reported as such, as the rest of a linked batch with
+		// one fails too.
+		failure, failed := failures[uint32(i)]
+		if !failed {
+			_, err := storeAccountMetadata(ctx, metadata[i])
+			if err != nil {
+				rlog.Error("failed to store account metadata", "error", err, "accountId", result.AccountId)
+				return nil, err
+			}
+		}
+		if failed {
+			accountErr := ledger.AccountError(failure)
+			result.Created = false
+			result.Error = accountErr.Code.String()
+			result.Reason = ledger.AccountReason(failure)
+		}
+		response.Results[i] = result
+	}
+	return response, nil
+}
@@ -4,45 +4,83 @@ import (
 	"context"
 	"encore.app/app/workflow"
 	"encore.dev/rlog"
-	"github.com/google/uuid"
 	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
-	"go.temporal.io/sdk/client"
 )
 
+type AuthorizeParams struct {
+	IdempotencyKey string `header:"Idempotency-Key"`
+	// MerchantId, if set, must be given again when presenting against the
+	// authorization. The authorization settles to the merchant's settlement
+	// account, or the treasury account of the currency for merchants without
+	// one.
+	MerchantId string
+	Currency   string
+}
+
 type AuthorizeResponse struct {
-	Authorized bool
+	Authorized      bool
+	AuthorizationId string
+	Amount          uint64
+	Currency        string
 }
 
 //encore:api public method=POST path=/authorize/:accountId/:amount
-func (s *Service) Authorize(ctx context.Context, accountId string, amount uint64) (*AuthorizeResponse, error) {
-	options := client.StartWorkflowOptions{
-		ID:        uuid.New().String(),
-		TaskQueue: taskQueue,
-	}
-	accountIdCasted, _ := tbtypes.HexStringToUint128(accountId)
-	we, err := s.temporalClient.ExecuteWorkflow(ctx, options, workflow.Auth, accountIdCasted, amount)
+func (s *Service) Authorize(ctx context.Context, accountId string, amount uint64, params *AuthorizeParams) (*AuthorizeResponse, error) {
+	request := []interface{}{"authorize", accountId, amount, params}
+	return idempotent(ctx, s.idempotencyKeys, params.IdempotencyKey, request, func(requestKey string) (*AuthorizeResponse, error) {
+		return s.authorize(ctx, accountId, amount, params, requestKey)
+	})
+}
 
+func (s *Service) authorize(ctx context.Context, accountId string, amount uint64, params *AuthorizeParams, requestKey string) (*AuthorizeResponse, error) {
+	err := checkAmount("amount", amount)
+	if err != nil {
+		return nil, err
+	}
+	accountIdCasted, err := parseId("accountId", accountId)
 	if err != nil {
-		rlog.Error("failed to start workflow", "error", err)
+		return nil, err
+	}
+	accounts, err := s.ledger.LookupAccounts([]tbtypes.Uint128{accountIdCasted})
+	if err != nil {
+		rlog.Error("failed to fetch accounts", "error", err)
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		rlog.Info("account not found", "accountId", accountId)
+		return &AuthorizeResponse{Authorized: false}, nil
+	}
+	currency, err := s.accountCurrency("Currency", params.Currency, accounts[0].Ledger)
+	if err != nil {
+		return nil, err
+	}
+	creditAccountId, err := s.settlementAccount(params.MerchantId, currency)
+	if err != nil {
+		return nil, err
+	}
+	operation := workflow.AccountOperation{
+		Type:            workflow.OperationAuthorize,
+		RequestId:       requestId(workflow.OperationAuthorize, requestKey),
+		Amount:          amount,
+		Ledger:          currency.Ledger,
+		CreditAccountId: creditAccountId,
+		HoldDuration:    holdDuration(),
+		MerchantId:      params.MerchantId,
+	}
+	err = s.signalAccount(ctx, accountIdCasted, operation)
+	if err != nil {
+		rlog.Error("failed to signal account workflow", "error", err)
 		return &AuthorizeResponse{Authorized: false}, err
 	}
-	rlog.Info("started workflow", "id", we.GetID(), "run_id", we.GetRunID())
+	rlog.Info("queued authorization", "id", operation.RequestId)
 
 	var transferId tbtypes.Uint128
-	err = we.Get(ctx, &transferId)
+	err = s.awaitOperation(ctx, operation.RequestId, &transferId)
 	if err != nil {
 		return &AuthorizeResponse{Authorized: false}, err
 	}
 	if transferId == workflow.InvalidTransferId {
 		return &AuthorizeResponse{Authorized: false}, nil
 	}
-	options = client.StartWorkflowOptions{
-		ID:        uuid.New().String(),
-		TaskQueue: taskQueue,
-	}
-	_, err = s.temporalClient.ExecuteWorkflow(ctx, options, workflow.Void, transferId)
-	if err != nil {
-		return &AuthorizeResponse{Authorized: false}, err
-	}
-	return &AuthorizeResponse{Authorized: true}, nil
+	return &AuthorizeResponse{Authorized: true, AuthorizationId: transferId.String(), Amount: amount, Currency: currency.Code}, nil
 }
@@ -2,29 +2,28 @@ package app
 
 import (
 	"context"
-	"encore.dev/rlog"
-	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"encore.app/app/ledger"
 )
 
 type AvailableBalanceResponse struct {
-	AvailableBalance uint64
+	// AvailableBalance is the posted balance less pending debits, a decimal
+	// string that is negative for an overdrawn account. OverdraftAdjustedBalance
+	// is what can be spent, never negative.
+	AvailableBalance         string
+	OverdraftAdjustedBalance string
+	Currency                 string
 }
 
 //encore:api public path=/available-balance/:accountId
 func (s *Service) AvailableBalance(ctx context.Context, accountId string) (*AvailableBalanceResponse, error) {
-	accountIdCasted, _ := tbtypes.HexStringToUint128(accountId)
-	accounts, err := s.tbClient.LookupAccounts([]tbtypes.Uint128{accountIdCasted})
-	if err != nil || len(accounts) == 0 {
-		rlog.Error("failed to fetch accounts", "error", err, "accountId", accountId, "accountIdCasted", accountIdCasted)
+	account, err := s.lookupAccount(accountId)
+	if err != nil {
 		return nil, err
 	}
-	var account tbtypes.Account
-
-	for _, acc := range accounts {
-		account = acc
-		break
-	}
+	balance := ledger.NewBalance(account)
 	return &AvailableBalanceResponse{
-		AvailableBalance: account.CreditsPosted - account.DebitsPosted,
+		AvailableBalance:         balance.Available.String(),
+		OverdraftAdjustedBalance: balance.OverdraftAdjusted.String(),
+		Currency:                 s.ledgerCurrency(account.Ledger).Code,
 	}, nil
 }
@@ -2,6 +2,8 @@ package app
 
 import (
 	"context"
+	"encore.app/app/ledger"
+	"encore.dev/beta/errs"
 	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
 	"log"
 )
@@ -11,26 +13,50 @@ type BalanceResponse struct {
 	CreditsPosted  uint64
 	DebitsPending  uint64
 	CreditsPending uint64
+	Currency       string
+	// The balances are decimal strings, as they can be negative and exceed 64
+	// bits, see ledger.Balance.
+	LedgerBalance            string
+	PendingBalance           string
+	AvailableBalance         string
+	Overdraft                string
+	OverdraftAdjustedBalance string
 }
 
 //encore:api public path=/balance/:accountId
 func (s *Service) Balance(ctx context.Context, accountId string) (*BalanceResponse, error) {
-	accountIdCasted, _ := tbtypes.HexStringToUint128(accountId)
-	accounts, err := s.tbClient.LookupAccounts([]tbtypes.Uint128{accountIdCasted})
+	account, err := s.lookupAccount(accountId)
 	if err != nil {
-		log.Printf("Could not fetch accounts: %s", err)
 		return nil, err
 	}
-	var account tbtypes.Account
-
-	for _, acc := range accounts {
-		account = acc
-		break
-	}
+	balance := ledger.NewBalance(account)
 	return &BalanceResponse{
-		DebitsPosted:   account.DebitsPosted,
-		CreditsPosted:  account.CreditsPosted,
-		DebitsPending:  account.DebitsPending,
-		CreditsPending: account.CreditsPending,
+		DebitsPosted:             account.DebitsPosted,
+		CreditsPosted:            account.CreditsPosted,
+		DebitsPending:            account.DebitsPending,
+		CreditsPending:           account.CreditsPending,
+		Currency:                 s.ledgerCurrency(account.Ledger).Code,
+		LedgerBalance:            balance.Ledger.String(),
+		PendingBalance:           balance.Pending.String(),
+		AvailableBalance:         balance.Available.String(),
+		Overdraft:                balance.Overdraft.String(),
+		OverdraftAdjustedBalance: balance.OverdraftAdjusted.String(),
 	}, nil
 }
+
+// lookupAccount looks up the account with the ID accountId.
+func (s *Service) lookupAccount(accountId string) (tbtypes.Account, error) {
+	accountIdCasted, err := parseId("accountId", accountId)
+	if err != nil {
+		return tbtypes.Account{}, err
+	}
+	accounts, err := s.ledger.LookupAccounts([]tbtypes.Uint128{accountIdCasted})
+	if err != nil {
+		log.Printf("Could not fetch accounts: %s", err)
+		return tbtypes.Account{}, err
+	}
+	if len(accounts) == 0 {
+		return tbtypes.Account{}, &errs.Error{Code: errs.NotFound, Message: "account not found"}
+	}
+	return accounts[0], nil
+}
@@ -0,0 +1,80 @@
+// The values marked * are defaults, for running locally. The blocks at the end
+// override them per environment.
+
+// Set to "memory" to run without a TigerBeetle cluster.
+LedgerBackend: *"tigerbeetle" | "memory"
+
+Temporal: {
+	HostPort:  *"localhost:7233" | string
+	Namespace: *"default" | string
+	TLS:       *false | bool
+	// Empty for "<environment>-task-queue".
+	TaskQueue: ""
+}
+
+Redis: {
+	Addr: *"localhost:6379" | string
+	DB:   0
+}
+
+TigerBeetle: {
+	ClusterId:   0
+	Addresses:   *["3000"] | [...string]
+	Concurrency: *1 | uint
+}
+
+Health: {
+	StartupAttempts:     *5 | uint
+	StartupRetrySeconds: 2
+	TimeoutSeconds:      5
+}
+
+AuthorizationHoldSeconds: 10
+
+// One of "redis", "memory" or "sql".
+AuthorizationStore: *"redis" | "memory" | "sql"
+
+// One of "redis", "memory" or "sql".
+IdempotencyStore:             *"redis" | "memory" | "sql"
+IdempotencyKeyRetentionHours: 24
+
+PresentmentTolerancePercent: 20
+
+// Accounts created before currencies were configured are on ledger 1.
+DefaultCurrency: "USD"
+Currencies: [
+	{Code: "USD", Ledger: 1, Exponent: 2, TreasuryAccountId: "1234567", SuspenseAccountId: "5001", FeesAccountId: "fee1", FxAccountId: "f001"},
+	{Code: "EUR", Ledger: 2, Exponent: 2, TreasuryAccountId: "1234568", SuspenseAccountId: "5002", FeesAccountId: "fee2", FxAccountId: "f002"},
+	{Code: "GBP", Ledger: 3, Exponent: 2, TreasuryAccountId: "1234569", SuspenseAccountId: "5003", FeesAccountId: "fee3", FxAccountId: "f003"},
+]
+
+FxRates: [
+	{From: "EUR", To: "USD", Rate: "1.0850", SpreadBasisPoints: 50},
+	{From: "GBP", To: "USD", Rate: "1.2700", SpreadBasisPoints: 50},
+	{From: "EUR", To: "GBP", Rate: "0.8550", SpreadBasisPoints: 50},
+]
+
+// e.g. {MerchantId: "acme", Currency: "USD", SettlementAccountId: "ac01"}
+Merchants: []
+
+BootstrapSystemAccounts: true
+
+// Tests run without TigerBeetle or Redis.
+if #Meta.Environment.Type == "test" {
+	LedgerBackend:      "memory"
+	AuthorizationStore: "memory"
+	IdempotencyStore:   "memory"
+}
+
+// Deployed environments connect to Temporal over TLS and keep authorizations
+// and idempotency keys in the service's database rather than Redis.
+if #Meta.Environment.Cloud != "local" {
+	Temporal: TLS:      true
+	AuthorizationStore: "sql"
+	IdempotencyStore:   "sql"
+	Health: StartupAttempts: 10
+}
+
+if #Meta.Environment.Type == "production" {
+	TigerBeetle: Concurrency: 4
+}
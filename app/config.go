@@ -0,0 +1,154 @@
+package app
+
+import (
+	"encore.dev/config"
+)
+
+type Config struct {
+	// LedgerBackend selects the ledger implementation, either "tigerbeetle" or
+	// "memory". The in-memory ledger loses all state on restart.
+	LedgerBackend string
+
+	Temporal    TemporalConfig
+	Redis       RedisConfig
+	TigerBeetle TigerBeetleConfig
+	Health      HealthConfig
+
+	// AuthorizationHoldSeconds is how long authorizations hold funds before
+	// they expire, restarted by increments.
+	AuthorizationHoldSeconds uint64
+
+	// AuthorizationStore selects where pending authorizations are indexed:
+	// "redis", "memory" or "sql" (the service's Postgres database).
+	AuthorizationStore string
+
+	// IdempotencyStore selects where responses to requests made with an
+	// Idempotency-Key are kept: "redis", "memory" or "sql".
+	IdempotencyStore string
+
+	// IdempotencyKeyRetentionHours is how long a response is replayed for
+	// requests repeating its idempotency key.
+	IdempotencyKeyRetentionHours uint64
+
+	// PresentmentTolerancePercent is how much larger than the presented amount
+	// an authorization may be for a presentment without an authorization ID
+	// to match it.
+	PresentmentTolerancePercent uint64
+
+	// Currencies are the currencies the service keeps books in, each on its
+	// own ledger. Amounts are in minor units of their currency. Requests that
+	// don't name a currency are in DefaultCurrency.
+	Currencies      []CurrencyConfig
+	DefaultCurrency string
+
+	// FxRates are the exchange rates of FX transfers.
+	FxRates []FxRateConfig
+
+	// Merchants are the settlement accounts of merchants, credited by their
+	// authorizations instead of the currency's treasury account.
+	Merchants []MerchantConfig
+
+	// BootstrapSystemAccounts creates the system accounts of the currencies
+	// and the settlement accounts of the merchants when the service starts, if
+	// they don't exist.
+	BootstrapSystemAccounts bool
+}
+
+type TemporalConfig struct {
+	// HostPort is the address of the Temporal frontend.
+	HostPort  string
+	Namespace string
+	// TLS connects to Temporal over TLS, authenticating with the client
+	// certificate in the TemporalTLSCert and TemporalTLSKey secrets unless
+	// their values are empty.
+	TLS bool
+	// TaskQueue is the task queue of the service's workflows. Defaults to
+	// "<environment>-task-queue".
+	TaskQueue string
+}
+
+type RedisConfig struct {
+	// Addr is the host:port of Redis. The password is the RedisPassword
+	// secret.
+	Addr string
+	DB   int
+}
+
+type TigerBeetleConfig struct {
+	ClusterId uint32
+	// Addresses are the addresses of the cluster's replicas.
+	Addresses   []string
+	Concurrency uint
+}
+
+type HealthConfig struct {
+	// StartupAttempts is how many times Temporal, TigerBeetle and Redis are
+	// checked when the service starts, StartupRetrySeconds apart, before it
+	// fails to start.
+	StartupAttempts     uint
+	StartupRetrySeconds uint64
+	// TimeoutSeconds bounds each check, and ledger requests, which otherwise
+	// wait for an unreachable cluster indefinitely.
+	TimeoutSeconds uint64
+}
+
+type CurrencyConfig struct {
+	// Code is the ISO 4217 code of the currency.
+	Code string
+	// Ledger is the ledger the currency's accounts are on.
+	Ledger uint32
+	// Exponent is the number of decimals of the currency's minor unit, e.g. 2
+	// for cents.
+	Exponent int
+	// TreasuryAccountId is credited by authorizations in the currency, unless
+	// the merchant has a settlement account in Merchants.
+	TreasuryAccountId string
+	// SuspenseAccountId holds funds that can't be allocated yet.
+	SuspenseAccountId string
+	// FeesAccountId collects fees.
+	FeesAccountId string
+	// FxAccountId is the currency's FX liquidity account. FX transfers into
+	// the currency are funded from it and transfers out of the currency
+	// credited to it. Currencies without one can't be exchanged.
+	FxAccountId string
+}
+
+type MerchantConfig struct {
+	MerchantId string
+	// Currency is the ISO 4217 code of the authorizations settled to
+	// SettlementAccountId.
+	Currency            string
+	SettlementAccountId string
+}
+
+type FxRateConfig struct {
+	// From and To are the ISO 4217 codes of the currencies, Rate the amount
+	// of To one unit of From buys, as a decimal, e.g. "1.0825". The inverse
+	// rate is used to exchange To for From unless it is configured too.
+	From string
+	To   string
+	Rate string
+	// SpreadBasisPoints is the service's margin, deducted from the converted
+	// amount.
+	SpreadBasisPoints uint64
+}
+
+var cfg = config.Load[*Config]()
+
+// secrets must all be set in every environment, Encore does not start the
+// service otherwise. Those that are not needed are set to an empty value, see
+// unused.
+var secrets struct {
+	// RedisPassword is the password of Redis, empty if it has none.
+	RedisPassword string
+	// TemporalTLSCert and TemporalTLSKey are the PEM encoded client
+	// certificate and key for Temporal, empty to connect without one.
+	TemporalTLSCert string
+	TemporalTLSKey  string
+}
+
+// unused reports whether a secret is not used in the environment: set, as
+// Encore requires, but to an empty value.
+func unused(secret string) bool {
+	return secret == ""
+}
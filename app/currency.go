@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"encore.app/app/ledger"
+	"encore.app/app/workflow"
+	"encore.dev/beta/errs"
+	"fmt"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+)
+
+type CurrenciesResponse struct {
+	Currencies []CurrencyResponse
+}
+
+type CurrencyResponse struct {
+	Code     string
+	Ledger   uint32
+	Exponent int
+	// The system accounts of the currency, empty if it has none, see
+	// ledger.Currency.
+	TreasuryAccountId string
+	SuspenseAccountId string
+	FeesAccountId     string
+	FxAccountId       string
+	// Default is set for the currency of requests that do not name one.
+	Default bool
+}
+
+//encore:api public method=GET path=/currencies
+func (s *Service) Currencies(ctx context.Context) (*CurrenciesResponse, error) {
+	response := &CurrenciesResponse{}
+	for _, currency := range s.currencies.All() {
+		response.Currencies = append(response.Currencies, CurrencyResponse{
+			Code:              currency.Code,
+			Ledger:            currency.Ledger,
+			Exponent:          currency.Exponent,
+			TreasuryAccountId: optionalId(currency.TreasuryAccountId),
+			SuspenseAccountId: optionalId(currency.SuspenseAccountId),
+			FeesAccountId:     optionalId(currency.FeesAccountId),
+			FxAccountId:       optionalId(currency.FxAccountId),
+			Default:           currency.Code == s.currencies.Default.Code,
+		})
+	}
+	return response, nil
+}
+
+// optionalId formats an ID that may not be set, empty if it isn't.
+func optionalId(id tbtypes.Uint128) string {
+	if id == workflow.InvalidTransferId {
+		return ""
+	}
+	return id.String()
+}
+
+// newCurrencies is the registry of the configured currencies.
+func newCurrencies() (*ledger.Currencies, error) {
+	currencies := make([]ledger.Currency, len(cfg.Currencies))
+	for i, currency := range cfg.Currencies {
+		currencies[i] = ledger.Currency{Code: currency.Code, Ledger: currency.Ledger, Exponent: currency.Exponent}
+		accounts := []struct {
+			name  string
+			value string
+			id    *tbtypes.Uint128
+		}{
+			{"treasury", currency.TreasuryAccountId, &currencies[i].TreasuryAccountId},
+			{"suspense", currency.SuspenseAccountId, &currencies[i].SuspenseAccountId},
+			{"fees", currency.FeesAccountId, &currencies[i].FeesAccountId},
+			{"FX", currency.FxAccountId, &currencies[i].FxAccountId},
+		}
+		for _, account := range accounts {
+			if account.value == "" {
+				continue
+			}
+			id, err := ledger.ParseId(account.value)
+			if err != nil {
+				return nil, fmt.Errorf("%s account of %s: %v", account.name, currency.Code, err)
+			}
+			*account.id = id
+		}
+	}
+	return ledger.NewCurrencies(currencies, cfg.DefaultCurrency)
+}
+
+// lookupCurrency is the currency with the code given by the request parameter
+// name, or the default currency if it is empty.
+func (s *Service) lookupCurrency(name string, code string) (ledger.Currency, error) {
+	if code == "" {
+		return s.currencies.Default, nil
+	}
+	currency, ok := s.currencies.Lookup(code)
+	if !ok {
+		return ledger.Currency{}, &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("%s %q is not a supported currency", name, code)}
+	}
+	return currency, nil
+}
+
+// ledgerCurrency is the currency of a ledger. Ledgers without a currency have
+// one without a code.
+func (s *Service) ledgerCurrency(ledgerId uint32) ledger.Currency {
+	currency, ok := s.currencies.ForLedger(ledgerId)
+	if !ok {
+		return ledger.Currency{Ledger: ledgerId}
+	}
+	return currency
+}
+
+// accountCurrency is the currency of the amounts of an account, or of an
+// authorization, on a ledger. code, the currency given by the request
+// parameter name, must be that currency if it is set.
+func (s *Service) accountCurrency(name string, code string, ledgerId uint32) (ledger.Currency, error) {
+	currency := s.ledgerCurrency(ledgerId)
+	if code != "" {
+		requested, err := s.lookupCurrency(name, code)
+		if err != nil {
+			return ledger.Currency{}, err
+		}
+		if requested.Ledger != currency.Ledger {
+			return ledger.Currency{}, &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("%s %s is not the account's currency", name, requested.Code)}
+		}
+	}
+	return currency, nil
+}
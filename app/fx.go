@@ -0,0 +1,219 @@
+package app
+
+import (
+	"context"
+	"encore.app/app/ledger"
+	"encore.app/app/workflow"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"fmt"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"math/big"
+	"strings"
+)
+
+// fxRateDecimals is the precision rates are recorded with.
+const fxRateDecimals = 10
+
+type FxTransferParams struct {
+	IdempotencyKey string `header:"Idempotency-Key"`
+
+	// DebitAccountId is debited Amount, in minor units of its currency, and
+	// CreditAccountId credited the converted amount in its own currency.
+	DebitAccountId  string
+	CreditAccountId string
+	Amount          uint64
+}
+
+// FxTransferResponse is the debit leg of the transfer, in the debit account's
+// currency, with the credit leg and the rate it was converted at.
+type FxTransferResponse struct {
+	TransferResponse
+	Fx FxDetails
+}
+
+// FxDetails describe an FX transfer: a linked pair of transfers, the debit
+// leg from the debit account to the FX liquidity account of its currency and
+// the credit leg from the FX liquidity account of the other currency to the
+// credit account.
+type FxDetails struct {
+	DebitTransferId  string
+	CreditTransferId string
+	DebitCurrency    string
+	CreditCurrency   string
+	DebitAmount      uint64
+	CreditAmount     uint64
+	// Rate is the amount of CreditCurrency one unit of DebitCurrency bought,
+	// before the spread, a decimal.
+	Rate              string
+	SpreadBasisPoints uint64
+}
+
+//encore:api public method=POST path=/fx-transfer
+func (s *Service) FxTransfer(ctx context.Context, params *FxTransferParams) (*FxTransferResponse, error) {
+	request := []interface{}{"fx-transfer", params}
+	return idempotent(ctx, s.idempotencyKeys, params.IdempotencyKey, request, func(requestKey string) (*FxTransferResponse, error) {
+		return s.fxTransfer(ctx, params, requestKey)
+	})
+}
+
+func (s *Service) fxTransfer(ctx context.Context, params *FxTransferParams, requestKey string) (*FxTransferResponse, error) {
+	err := checkAmount("Amount", params.Amount)
+	if err != nil {
+		return nil, err
+	}
+	debitAccountId, err := parseId("DebitAccountId", params.DebitAccountId)
+	if err != nil {
+		return nil, err
+	}
+	creditAccountId, err := parseId("CreditAccountId", params.CreditAccountId)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := s.ledger.LookupAccounts([]tbtypes.Uint128{debitAccountId, creditAccountId})
+	if err != nil {
+		rlog.Error("failed to fetch accounts", "error", err)
+		return nil, err
+	}
+	var debitCurrency, creditCurrency ledger.Currency
+	for _, account := range accounts {
+		switch account.ID {
+		case debitAccountId:
+			debitCurrency = s.ledgerCurrency(account.Ledger)
+		case creditAccountId:
+			creditCurrency = s.ledgerCurrency(account.Ledger)
+		}
+	}
+	switch {
+	case debitCurrency.Ledger == 0 || creditCurrency.Ledger == 0:
+		return nil, &errs.Error{Code: errs.NotFound, Message: "account not found"}
+	case debitCurrency.Ledger == creditCurrency.Ledger:
+		return nil, &errs.Error{Code: errs.InvalidArgument, Message: "the accounts are in the same currency, use a transfer"}
+	case debitCurrency.FxAccountId == workflow.InvalidTransferId || creditCurrency.FxAccountId == workflow.InvalidTransferId:
+		return nil, &errs.Error{Code: errs.FailedPrecondition, Message: fmt.Sprintf("%s can't be exchanged for %s", debitCurrency.Code, creditCurrency.Code)}
+	}
+
+	exchange := ledger.NewFxTransfer(func(n uint64) tbtypes.Uint128 {
+		return requestTransferId(requestKey, n)
+	}, debitAccountId, creditAccountId, debitCurrency, creditCurrency, params.Amount)
+	// A retry converts at the rate the first attempt recorded.
+	fx, retried, err := lookupFxDetails(ctx, exchange.DebitLegId)
+	if err != nil {
+		rlog.Error("failed to get FX transfer", "error", err)
+		return nil, err
+	}
+	if !retried {
+		quote, err := s.rates.Quote(ctx, debitCurrency.Code, creditCurrency.Code)
+		if err != nil {
+			return nil, err
+		}
+		creditAmount, err := ledger.ConvertAmount(params.Amount, debitCurrency, creditCurrency, quote.Rate, quote.SpreadBasisPoints)
+		if err != nil {
+			return nil, err
+		}
+		fx = FxDetails{
+			DebitTransferId:   exchange.DebitLegId.String(),
+			CreditTransferId:  exchange.CreditLegId.String(),
+			DebitCurrency:     debitCurrency.Code,
+			CreditCurrency:    creditCurrency.Code,
+			DebitAmount:       params.Amount,
+			CreditAmount:      creditAmount,
+			Rate:              formatRate(quote.Rate),
+			SpreadBasisPoints: quote.SpreadBasisPoints,
+		}
+		// The rate is recorded before the transfers are created so that it is
+		// never missing for a transfer that was.
+		err = storeFxDetails(ctx, fx)
+		if err != nil {
+			rlog.Error("failed to store FX transfer", "error", err)
+			return nil, err
+		}
+	}
+
+	exchange.CreditAmount = fx.CreditAmount
+	res, err := ledger.CreateTransfersOnce(s.ledger, exchange.Transfers())
+	if err == nil && len(res) > 0 {
+		rlog.Info("FX transfer not created", "result", res[0].Result.String())
+		err = fxTransferError(res)
+	}
+	if err != nil {
+		rlog.Error("failed to create FX transfer", "error", err)
+		// The rate stays recorded if the transfers may have been created.
+		if !outcomeUnknown(err) {
+			if deleteErr := deleteFxDetails(ctx, exchange.DebitLegId); deleteErr != nil {
+				rlog.Error("failed to delete FX transfer", "error", deleteErr)
+			}
+		}
+		return nil, err
+	}
+
+	return &FxTransferResponse{
+		TransferResponse: TransferResponse{
+			TransferId:      exchange.DebitLegId.String(),
+			DebitAccountId:  debitAccountId.String(),
+			CreditAccountId: creditAccountId.String(),
+			Amount:          params.Amount,
+			Currency:        debitCurrency.Code,
+		},
+		Fx: fx,
+	}, nil
+}
+
+// fxTransferError is the error of the leg that failed a linked pair, rather
+// than linked_event_failed.
+func fxTransferError(res []tbtypes.TransferEventResult) error {
+	failure := res[0].Result
+	for _, r := range res {
+		if r.Result != tbtypes.TransferLinkedEventFailed {
+			failure = r.Result
+			break
+		}
+	}
+	return ledger.TransferError(failure)
+}
+
+// formatRate formats a rate as a decimal without trailing zeros.
+func formatRate(rate *big.Rat) string {
+	formatted := strings.TrimRight(rate.FloatString(fxRateDecimals), "0")
+	return strings.TrimSuffix(formatted, ".")
+}
+
+func storeFxDetails(ctx context.Context, fx FxDetails) error {
+	_, err := sqldb.Exec(ctx, `
+		INSERT INTO fx_transfers (debit_transfer_id, credit_transfer_id, debit_currency, credit_currency,
+			debit_amount, credit_amount, rate, spread_basis_points)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, fx.DebitTransferId, fx.CreditTransferId, fx.DebitCurrency, fx.CreditCurrency,
+		int64(fx.DebitAmount), int64(fx.CreditAmount), fx.Rate, int64(fx.SpreadBasisPoints))
+	return err
+}
+
+func deleteFxDetails(ctx context.Context, debitTransferId tbtypes.Uint128) error {
+	_, err := sqldb.Exec(ctx, `DELETE FROM fx_transfers WHERE debit_transfer_id = $1`, debitTransferId.String())
+	return err
+}
+
+// lookupFxDetails returns the FX transfer a transfer is a leg of, and false if
+// it isn't one.
+func lookupFxDetails(ctx context.Context, transferId tbtypes.Uint128) (FxDetails, bool, error) {
+	var fx FxDetails
+	var debitAmount, creditAmount, spread int64
+	err := sqldb.QueryRow(ctx, `
+		SELECT debit_transfer_id, credit_transfer_id, debit_currency, credit_currency,
+			debit_amount, credit_amount, rate, spread_basis_points
+		FROM fx_transfers
+		WHERE debit_transfer_id = $1 OR credit_transfer_id = $1
+	`, transferId.String()).Scan(&fx.DebitTransferId, &fx.CreditTransferId, &fx.DebitCurrency, &fx.CreditCurrency,
+		&debitAmount, &creditAmount, &fx.Rate, &spread)
+	if err == sqldb.ErrNoRows {
+		return FxDetails{}, false, nil
+	}
+	if err != nil {
+		return FxDetails{}, false, err
+	}
+	fx.DebitAmount = uint64(debitAmount)
+	fx.CreditAmount = uint64(creditAmount)
+	fx.SpreadBasisPoints = uint64(spread)
+	return fx, true, nil
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"encore.dev/beta/errs"
+	"fmt"
+	"math/big"
+)
+
+// FxQuote is the rate an FX transfer is made at. Rate is the amount of the
+// target currency one unit of the source currency buys, before the spread.
+type FxQuote struct {
+	Rate              *big.Rat
+	SpreadBasisPoints uint64
+}
+
+// RateProvider quotes exchange rates for FX transfers.
+type RateProvider interface {
+	// Quote returns the rate to exchange from for to, ISO 4217 codes. It
+	// fails with a NotFound error for pairs it has no rate for.
+	Quote(ctx context.Context, from string, to string) (FxQuote, error)
+}
+
+// StaticRateProvider quotes the fixed rates of a table, FxRates in the
+// service's configuration.
+type StaticRateProvider struct {
+	quotes map[[2]string]FxQuote
+}
+
+func NewStaticRateProvider(rates []FxRateConfig) (*StaticRateProvider, error) {
+	provider := &StaticRateProvider{quotes: map[[2]string]FxQuote{}}
+	inverses := map[[2]string]FxQuote{}
+	for _, rate := range rates {
+		value, ok := new(big.Rat).SetString(rate.Rate)
+		if !ok || value.Sign() <= 0 {
+			return nil, fmt.Errorf("rate %q from %s to %s is not a positive decimal", rate.Rate, rate.From, rate.To)
+		}
+		if rate.SpreadBasisPoints >= 10000 {
+			return nil, fmt.Errorf("spread from %s to %s is 100%% or more", rate.From, rate.To)
+		}
+		provider.quotes[[2]string{rate.From, rate.To}] = FxQuote{Rate: value, SpreadBasisPoints: rate.SpreadBasisPoints}
+		inverses[[2]string{rate.To, rate.From}] = FxQuote{Rate: new(big.Rat).Inv(value), SpreadBasisPoints: rate.SpreadBasisPoints}
+	}
+	for pair, quote := range inverses {
+		if _, ok := provider.quotes[pair]; !ok {
+			provider.quotes[pair] = quote
+		}
+	}
+	return provider, nil
+}
+
+func (p *StaticRateProvider) Quote(_ context.Context, from string, to string) (FxQuote, error) {
+	quote, ok := p.quotes[[2]string{from, to}]
+	if !ok {
+		return FxQuote{}, &errs.Error{Code: errs.NotFound, Message: fmt.Sprintf("no rate from %s to %s", from, to)}
+	}
+	return quote, nil
+}
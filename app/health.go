@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"encore.app/app/ledger"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"fmt"
+	"github.com/go-redis/redis"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"go.temporal.io/sdk/client"
+	"time"
+)
+
+const (
+	DependencyTemporal = "temporal"
+	DependencyLedger   = "ledger"
+	DependencyRedis    = "redis"
+)
+
+type LivenessResponse struct {
+	Status string
+}
+
+type ReadinessResponse struct {
+	Ready        bool
+	Dependencies []DependencyStatus
+}
+
+type DependencyStatus struct {
+	Name string
+	Up   bool
+	// Error is why the dependency is down.
+	Error string `json:",omitempty"`
+}
+
+// ReadinessDetails are the details of the Unavailable error of a service that
+// isn't ready.
+type ReadinessDetails struct {
+	Dependencies []DependencyStatus
+}
+
+func (ReadinessDetails) ErrDetails() {}
+
+// dependency is a backend the service needs, with a check that fails while it
+// can't be used.
+type dependency struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// Live reports that the service is running, whatever the state of its
+// dependencies.
+//
+//encore:api public method=GET path=/health/live
+func (s *Service) Live(ctx context.Context) (*LivenessResponse, error) {
+	return &LivenessResponse{Status: "ok"}, nil
+}
+
+// Ready checks the service's dependencies, failing with Unavailable if any of
+// them is down.
+//
+//encore:api public method=GET path=/health/ready
+func (s *Service) Ready(ctx context.Context) (*ReadinessResponse, error) {
+	response := &ReadinessResponse{Ready: true}
+	for _, d := range s.dependencies() {
+		status := DependencyStatus{Name: d.name, Up: true}
+		err := checkDependency(ctx, d)
+		if err != nil {
+			rlog.Warn("dependency is down", "dependency", d.name, "error", err)
+			status = DependencyStatus{Name: d.name, Error: err.Error()}
+			response.Ready = false
+		}
+		response.Dependencies = append(response.Dependencies, status)
+	}
+	if !response.Ready {
+		return nil, &errs.Error{
+			Code:    errs.Unavailable,
+			Message: "service is not ready",
+			Details: ReadinessDetails{Dependencies: response.Dependencies},
+		}
+	}
+	return response, nil
+}
+
+func (s *Service) dependencies() []dependency {
+	dependencies := []dependency{
+		{DependencyTemporal, temporalCheck(s.temporalClient)},
+		{DependencyLedger, ledgerCheck(s.ledger)},
+	}
+	if s.redisClient != nil {
+		dependencies = append(dependencies, dependency{DependencyRedis, redisCheck(s.redisClient)})
+	}
+	return dependencies
+}
+
+func temporalCheck(c client.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := c.CheckHealth(ctx, &client.CheckHealthRequest{})
+		return err
+	}
+}
+
+// ledgerCheck looks up an account, which fails or times out while the ledger
+// can't be reached. No account has the zero ID, so it looks up nothing.
+func ledgerCheck(l ledger.Ledger) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := l.LookupAccounts([]tbtypes.Uint128{{}})
+		return err
+	}
+}
+
+func redisCheck(c *redis.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return c.Ping().Err()
+	}
+}
+
+// healthTimeout bounds dependency checks and ledger requests.
+func healthTimeout() time.Duration {
+	return time.Duration(cfg.Health.TimeoutSeconds) * time.Second
+}
+
+// checkDependency runs a dependency's check, failing if it takes longer than
+// healthTimeout.
+func checkDependency(ctx context.Context, d dependency) error {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- d.check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%s did not respond: %v", d.name, ctx.Err())
+	}
+}
+
+// awaitDependency checks a dependency when the service starts, retrying up to
+// StartupAttempts times so that the service can start alongside it.
+func awaitDependency(d dependency) error {
+	attempts := cfg.Health.StartupAttempts
+	if attempts == 0 {
+		attempts = 1
+	}
+	var err error
+	for attempt := uint(1); attempt <= attempts; attempt++ {
+		err = checkDependency(context.Background(), d)
+		if err == nil {
+			return nil
+		}
+		rlog.Warn("dependency is not available", "dependency", d.name, "attempt", attempt, "error", err)
+		if attempt < attempts {
+			time.Sleep(time.Duration(cfg.Health.StartupRetrySeconds) * time.Second)
+		}
+	}
+	return fmt.Errorf("%s is not available after %d attempts: %v", d.name, attempts, err)
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encore.app/app/idempotency"
+	"encore.app/app/ledger"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"time"
+)
+
+const (
+	// idempotencyClaimTimeout is how long a key stays claimed by a request
+	// that has not completed, or whose outcome is unknown.
+	idempotencyClaimTimeout = 5 * time.Minute
+	// requestHashLength is how many hex digits of the request hash a request
+	// key includes.
+	requestHashLength = 16
+)
+
+// idempotent runs fn for a request made with an idempotency key, and returns the
+// response of the first request instead for later requests with the same key.
+// Every endpoint that changes state takes the key as the IdempotencyKey field
+// of its parameters, from the Idempotency-Key header, and runs through it.
+// A key reused for a different request, or while the first request is still
+// in progress, is rejected. Requests that fail before they could have taken
+// effect are not stored and can be retried right away. Otherwise the key stays
+// claimed for idempotencyClaimTimeout, after which the request can be retried:
+// fn is given a request key to derive the IDs of what it creates from, see
+// requestId and requestTransferId, so that a retry finds what the first
+// attempt created. Without an idempotency key fn is always run, with an empty
+// request key.
+func idempotent[T any](ctx context.Context, store idempotency.Store, key string, request interface{}, fn func(requestKey string) (*T, error)) (*T, error) {
+	if key == "" {
+		return fn("")
+	}
+	encodedRequest, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := sha256.Sum256(encodedRequest)
+	requestHash := hex.EncodeToString(fingerprint[:])
+	retention := time.Duration(cfg.IdempotencyKeyRetentionHours) * time.Hour
+
+	record, err := store.Claim(ctx, key, requestHash, idempotencyClaimTimeout)
+	if err != nil {
+		rlog.Error("failed to claim idempotency key", "key", key, "error", err)
+		return nil, errs.WrapCode(err, errs.Unavailable, "could not claim idempotency key")
+	}
+	if record != nil {
+		switch {
+		case record.Request != requestHash:
+			return nil, &errs.Error{Code: errs.InvalidArgument, Message: "idempotency key was already used for a different request"}
+		case record.Response == nil:
+			return nil, &errs.Error{Code: errs.Aborted, Message: "a request with this idempotency key is in progress or its outcome is unknown, retry it later"}
+		}
+		var response T
+		err = json.Unmarshal(record.Response, &response)
+		if err != nil {
+			return nil, err
+		}
+		rlog.Info("replaying response", "key", key)
+		return &response, nil
+	}
+
+	// The hash tells apart requests reusing a key once its record has expired.
+	response, err := fn(key + "-" + requestHash[:requestHashLength])
+	if err != nil {
+		if outcomeUnknown(err) {
+			rlog.Warn("keeping idempotency key of request with unknown outcome", "key", key, "error", err)
+			return response, err
+		}
+		releaseErr := store.Release(ctx, key)
+		if releaseErr != nil {
+			rlog.Error("failed to release idempotency key", "key", key, "error", releaseErr)
+		}
+		return response, err
+	}
+	encodedResponse, err := json.Marshal(response)
+	if err == nil {
+		err = store.Complete(ctx, key, encodedResponse, retention)
+	}
+	if err != nil {
+		rlog.Error("failed to store response for idempotency key", "key", key, "error", err)
+	}
+	return response, nil
+}
+
+// outcomeUnknown reports whether a request that failed with err may still have
+// taken effect, because a backend failed or did not respond in time. Errors
+// the service or the ledger returned for an invalid request are known to have
+// changed nothing.
+func outcomeUnknown(err error) bool {
+	switch errs.Code(err) {
+	case errs.Unknown, errs.Internal, errs.Unavailable, errs.DeadlineExceeded, errs.Canceled, errs.DataLoss:
+		return true
+	}
+	return false
+}
+
+// requestTransferId is the ID of the n-th transfer a request creates. Requests
+// made with an idempotency key derive it from their request key, so that a
+// retry creates the same transfers, see ledger.CreateTransfersOnce.
+func requestTransferId(requestKey string, n uint64) tbtypes.Uint128 {
+	if requestKey == "" {
+		return ledger.NewId()
+	}
+	sum := sha256.Sum256([]byte("transfer-" + requestKey))
+	var id [16]byte
+	copy(id[:], sum[:])
+	return ledger.NthId(tbtypes.BytesToUint128(id), n)
+}
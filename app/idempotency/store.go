@@ -0,0 +1,136 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis"
+	"sync"
+	"time"
+)
+
+const (
+	StoreRedis  = "redis"
+	StoreMemory = "memory"
+	StoreSql    = "sql"
+)
+
+// Record is what is stored for an idempotency key. Response is nil while the
+// first request with the key is still in progress.
+type Record struct {
+	Request  string
+	Response []byte
+}
+
+// Store remembers the responses of requests made with an idempotency key for a
+// retention window.
+type Store interface {
+	// Claim records key as in progress for request, until timeout. If the key
+	// has already been claimed it returns the existing record instead.
+	Claim(ctx context.Context, key string, request string, timeout time.Duration) (*Record, error)
+	// Complete stores the response for a claimed key.
+	Complete(ctx context.Context, key string, response []byte, retention time.Duration) error
+	// Release forgets a claimed key, so that the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// RedisStore keeps records under idempotency:<key>, expiring them after the
+// retention window.
+type RedisStore struct {
+	Client *redis.Client
+}
+
+func redisKey(key string) string {
+	return "idempotency:" + key
+}
+
+func (r *RedisStore) Claim(ctx context.Context, key string, request string, timeout time.Duration) (*Record, error) {
+	encoded, err := json.Marshal(Record{Request: request})
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := r.Client.SetNX(redisKey(key), encoded, timeout).Result()
+	if err != nil || claimed {
+		return nil, err
+	}
+	existing, err := r.Client.Get(redisKey(key)).Bytes()
+	if err == redis.Nil {
+		// Expired in between, claim it again.
+		return r.Claim(ctx, key, request, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var record Record
+	err = json.Unmarshal(existing, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *RedisStore) Complete(_ context.Context, key string, response []byte, retention time.Duration) error {
+	existing, err := r.Client.Get(redisKey(key)).Bytes()
+	if err != nil {
+		return err
+	}
+	var record Record
+	err = json.Unmarshal(existing, &record)
+	if err != nil {
+		return err
+	}
+	record.Response = response
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return r.Client.Set(redisKey(key), encoded, retention).Err()
+}
+
+func (r *RedisStore) Release(_ context.Context, key string) error {
+	return r.Client.Del(redisKey(key)).Err()
+}
+
+// MemoryStore keeps records in process, for use with the in-memory ledger.
+// Records are lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+}
+
+type memoryRecord struct {
+	Record
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]memoryRecord{}}
+}
+
+func (m *MemoryStore) Claim(_ context.Context, key string, request string, timeout time.Duration) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if existing, ok := m.records[key]; ok && existing.expiresAt.After(now) {
+		record := existing.Record
+		return &record, nil
+	}
+	m.records[key] = memoryRecord{Record{Request: request}, now.Add(timeout)}
+	return nil, nil
+}
+
+func (m *MemoryStore) Complete(_ context.Context, key string, response []byte, retention time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record := m.records[key]
+	record.Response = response
+	record.expiresAt = time.Now().Add(retention)
+	m.records[key] = record
+	return nil
+}
+
+func (m *MemoryStore) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, key)
+	return nil
+}
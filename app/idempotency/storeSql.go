@@ -0,0 +1,54 @@
+package idempotency
+
+import (
+	"context"
+	"encore.dev/storage/sqldb"
+	"time"
+)
+
+// SqlStore keeps idempotency records in the service's Postgres database, see
+// app/migrations. Expired records are replaced when their key is claimed
+// again.
+type SqlStore struct{}
+
+func (SqlStore) Claim(ctx context.Context, key string, request string, timeout time.Duration) (*Record, error) {
+	res, err := sqldb.Exec(ctx, `
+		INSERT INTO idempotency_keys (key, request, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE
+		SET request = EXCLUDED.request, response = NULL, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= now()
+	`, key, request, time.Now().Add(timeout))
+	if err != nil {
+		return nil, err
+	}
+	if res.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	var record Record
+	err = sqldb.QueryRow(ctx, `
+		SELECT request, response FROM idempotency_keys
+		WHERE key = $1
+	`, key).Scan(&record.Request, &record.Response)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (SqlStore) Complete(ctx context.Context, key string, response []byte, retention time.Duration) error {
+	_, err := sqldb.Exec(ctx, `
+		UPDATE idempotency_keys SET response = $2, expires_at = $3
+		WHERE key = $1
+	`, key, response, time.Now().Add(retention))
+	return err
+}
+
+func (SqlStore) Release(ctx context.Context, key string) error {
+	_, err := sqldb.Exec(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE key = $1
+	`, key)
+	return err
+}
@@ -0,0 +1,93 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	type step struct {
+		// op is "claim", "complete", "release" or "wait".
+		op      string
+		request string
+		// want is the record a claim returns, nil if it claimed the key.
+		want *Record
+	}
+	const timeout = 50 * time.Millisecond
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"claim", []step{
+			{op: "claim", request: "a"},
+		}},
+		{"claim in progress", []step{
+			{op: "claim", request: "a"},
+			{op: "claim", request: "a", want: &Record{Request: "a"}},
+			{op: "claim", request: "b", want: &Record{Request: "a"}},
+		}},
+		{"claim completed", []step{
+			{op: "claim", request: "a"},
+			{op: "complete"},
+			{op: "claim", request: "a", want: &Record{Request: "a", Response: []byte("response")}},
+		}},
+		{"claim released", []step{
+			{op: "claim", request: "a"},
+			{op: "release"},
+			{op: "claim", request: "b"},
+		}},
+		{"claim expires", []step{
+			{op: "claim", request: "a"},
+			{op: "wait"},
+			{op: "claim", request: "b"},
+			{op: "claim", request: "a", want: &Record{Request: "b"}},
+		}},
+		{"completion extends the claim", []step{
+			{op: "claim", request: "a"},
+			{op: "complete"},
+			{op: "wait"},
+			{op: "claim", request: "a", want: &Record{Request: "a", Response: []byte("response")}},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryStore()
+			for i, s := range test.steps {
+				var err error
+				switch s.op {
+				case "claim":
+					var record *Record
+					record, err = store.Claim(ctx, "key", s.request, timeout)
+					switch {
+					case (record == nil) != (s.want == nil):
+						t.Errorf("step %d: got record %v, want %v", i, record, s.want)
+					case record != nil && (record.Request != s.want.Request || string(record.Response) != string(s.want.Response)):
+						t.Errorf("step %d: got record %+v, want %+v", i, *record, *s.want)
+					}
+				case "complete":
+					err = store.Complete(ctx, "key", []byte("response"), time.Hour)
+				case "release":
+					err = store.Release(ctx, "key")
+				case "wait":
+					time.Sleep(2 * timeout)
+				}
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeys(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, key := range []string{"a", "b"} {
+		record, err := store.Claim(ctx, key, "request", time.Hour)
+		if err != nil || record != nil {
+			t.Errorf("claiming %s: got %v, %v", key, record, err)
+		}
+	}
+}
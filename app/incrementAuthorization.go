@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"encore.app/app/workflow"
+	"encore.dev/rlog"
+)
+
+type IncrementAuthorizationParams struct {
+	IdempotencyKey string `header:"Idempotency-Key"`
+	Currency       string
+}
+
+type IncrementAuthorizationResponse struct {
+	Incremented     bool
+	AuthorizationId string
+	HeldAmount      uint64
+	Currency        string
+}
+
+//encore:api public method=POST path=/authorization/:authorizationId/increment/:amount
+func (s *Service) IncrementAuthorization(ctx context.Context, authorizationId string, amount uint64, params *IncrementAuthorizationParams) (*IncrementAuthorizationResponse, error) {
+	request := []interface{}{"increment", authorizationId, amount, params.Currency}
+	return idempotent(ctx, s.idempotencyKeys, params.IdempotencyKey, request, func(requestKey string) (*IncrementAuthorizationResponse, error) {
+		return s.incrementAuthorization(ctx, authorizationId, amount, params, requestKey)
+	})
+}
+
+func (s *Service) incrementAuthorization(ctx context.Context, authorizationId string, amount uint64, params *IncrementAuthorizationParams, requestKey string) (*IncrementAuthorizationResponse, error) {
+	err := checkAmount("amount", amount)
+	if err != nil {
+		return nil, err
+	}
+	authorizationIdCasted, err := parseId("authorizationId", authorizationId)
+	if err != nil {
+		return nil, err
+	}
+	authorization, found, err := s.lookupAuthorization(authorizationIdCasted)
+	if err != nil {
+		rlog.Error("failed to get authorization", "error", err)
+		return nil, err
+	}
+	if !found {
+		rlog.Info("authorization not found", "authorizationId", authorizationId)
+		return &IncrementAuthorizationResponse{Incremented: false, AuthorizationId: authorizationIdCasted.String()}, nil
+	}
+
+	currency, err := s.accountCurrency("Currency", params.Currency, authorization.Ledger)
+	if err != nil {
+		return nil, err
+	}
+	operation := workflow.AccountOperation{
+		Type:            workflow.OperationIncrement,
+		RequestId:       requestId(workflow.OperationIncrement, requestKey),
+		Amount:          amount,
+		HoldDuration:    holdDuration(),
+		AuthorizationId: authorizationIdCasted,
+	}
+	err = s.signalAccount(ctx, authorization.DebitAccountID, operation)
+	if err != nil {
+		rlog.Error("failed to signal account workflow", "error", err)
+		return nil, err
+	}
+	rlog.Info("queued authorization increment", "id", operation.RequestId)
+
+	var result workflow.IncrementResult
+	err = s.awaitOperation(ctx, operation.RequestId, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &IncrementAuthorizationResponse{
+		Incremented:     result.Incremented,
+		AuthorizationId: authorizationIdCasted.String(),
+		HeldAmount:      result.HeldAmount,
+		Currency:        currency.Code,
+	}, nil
+}
@@ -0,0 +1,49 @@
+package ledger
+
+import (
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"math/big"
+)
+
+// Balance is the balance of an account, credits less debits, as for the
+// customer accounts of the service. The amounts of an account are each 64 bits,
+// so their sums and differences are computed on big integers and can be
+// negative.
+type Balance struct {
+	// Ledger is the posted balance.
+	Ledger *big.Int
+	// Pending is the balance of the pending transfers, pending credits less
+	// pending debits.
+	Pending *big.Int
+	// Available is the posted balance less pending debits, which are held
+	// until they are posted or voided. Pending credits are not available until
+	// they are posted.
+	Available *big.Int
+	// Overdraft is how far Available is below zero, for accounts the ledger
+	// lets be overdrawn, and OverdraftAdjusted is Available without it: what
+	// can be spent, never negative.
+	Overdraft         *big.Int
+	OverdraftAdjusted *big.Int
+}
+
+// NewBalance is the balance of account.
+func NewBalance(account tbtypes.Account) Balance {
+	debitsPosted := new(big.Int).SetUint64(account.DebitsPosted)
+	creditsPosted := new(big.Int).SetUint64(account.CreditsPosted)
+	debitsPending := new(big.Int).SetUint64(account.DebitsPending)
+	creditsPending := new(big.Int).SetUint64(account.CreditsPending)
+
+	balance := Balance{
+		Ledger:            new(big.Int).Sub(creditsPosted, debitsPosted),
+		Pending:           new(big.Int).Sub(creditsPending, debitsPending),
+		Overdraft:         new(big.Int),
+		OverdraftAdjusted: new(big.Int),
+	}
+	balance.Available = new(big.Int).Sub(balance.Ledger, debitsPending)
+	if balance.Available.Sign() < 0 {
+		balance.Overdraft.Neg(balance.Available)
+	} else {
+		balance.OverdraftAdjusted.Set(balance.Available)
+	}
+	return balance
+}
@@ -0,0 +1,60 @@
+package ledger
+
+import (
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"math"
+	"testing"
+)
+
+func TestNewBalance(t *testing.T) {
+	tests := []struct {
+		name    string
+		account tbtypes.Account
+		// want is Ledger, Pending, Available, Overdraft and
+		// OverdraftAdjusted.
+		want [5]string
+	}{
+		{"empty", tbtypes.Account{}, [5]string{"0", "0", "0", "0", "0"}},
+		{"posted", tbtypes.Account{CreditsPosted: 100, DebitsPosted: 30}, [5]string{"70", "0", "70", "0", "70"}},
+		{
+			"pending debits are held",
+			tbtypes.Account{CreditsPosted: 100, DebitsPending: 40},
+			[5]string{"100", "-40", "60", "0", "60"},
+		},
+		{
+			"pending credits are not available",
+			tbtypes.Account{CreditsPosted: 100, CreditsPending: 40},
+			[5]string{"100", "40", "100", "0", "100"},
+		},
+		{
+			"overdrawn",
+			tbtypes.Account{CreditsPosted: 100, DebitsPosted: 80, DebitsPending: 50},
+			[5]string{"20", "-50", "-30", "30", "0"},
+		},
+		{
+			"beyond 64 bits",
+			tbtypes.Account{CreditsPosted: math.MaxUint64, CreditsPending: math.MaxUint64, DebitsPosted: 0},
+			[5]string{"18446744073709551615", "18446744073709551615", "18446744073709551615", "0", "18446744073709551615"},
+		},
+		{
+			"below -2^64",
+			tbtypes.Account{DebitsPosted: math.MaxUint64, DebitsPending: math.MaxUint64},
+			[5]string{"-18446744073709551615", "-18446744073709551615", "-36893488147419103230", "36893488147419103230", "0"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			balance := NewBalance(test.account)
+			got := [5]string{
+				balance.Ledger.String(),
+				balance.Pending.String(),
+				balance.Available.String(),
+				balance.Overdraft.String(),
+				balance.OverdraftAdjusted.String(),
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
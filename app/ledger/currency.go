@@ -0,0 +1,126 @@
+package ledger
+
+import (
+	"encore.dev/beta/errs"
+	"fmt"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Currency is a currency kept on its own ledger. Amounts in the ledger are in
+// minor units, Exponent is the number of decimals of the major unit: 2 for the
+// cents of USD, 0 for JPY.
+type Currency struct {
+	// Code is the ISO 4217 code, e.g. "EUR".
+	Code     string
+	Ledger   uint32
+	Exponent int
+	// The system accounts of the currency, zero if there are none.
+	// TreasuryAccountId is credited by authorizations of merchants without a
+	// settlement account, SuspenseAccountId holds funds that can't be
+	// allocated yet and FeesAccountId collects fees. FxAccountId is the
+	// liquidity account that FX transfers into and out of the currency go
+	// through.
+	TreasuryAccountId tbtypes.Uint128
+	SuspenseAccountId tbtypes.Uint128
+	FeesAccountId     tbtypes.Uint128
+	FxAccountId       tbtypes.Uint128
+}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Currencies is a registry of the currencies of the ledgers.
+type Currencies struct {
+	byCode   map[string]Currency
+	byLedger map[uint32]Currency
+	// Default is the currency of requests that do not name one.
+	Default Currency
+}
+
+// NewCurrencies is a registry of currencies, each on a different ledger.
+// defaultCode is the code of the default currency.
+func NewCurrencies(currencies []Currency, defaultCode string) (*Currencies, error) {
+	registry := &Currencies{byCode: map[string]Currency{}, byLedger: map[uint32]Currency{}}
+	for _, currency := range currencies {
+		switch {
+		case !currencyCode.MatchString(currency.Code):
+			return nil, fmt.Errorf("currency code %q is not an ISO 4217 code", currency.Code)
+		case currency.Ledger == 0:
+			return nil, fmt.Errorf("currency %s has no ledger", currency.Code)
+		case currency.Exponent < 0 || currency.Exponent > 18:
+			return nil, fmt.Errorf("currency %s has an exponent out of range", currency.Code)
+		}
+		if _, ok := registry.byCode[currency.Code]; ok {
+			return nil, fmt.Errorf("currency %s is registered twice", currency.Code)
+		}
+		if other, ok := registry.byLedger[currency.Ledger]; ok {
+			return nil, fmt.Errorf("currencies %s and %s share ledger %d", other.Code, currency.Code, currency.Ledger)
+		}
+		registry.byCode[currency.Code] = currency
+		registry.byLedger[currency.Ledger] = currency
+	}
+	defaultCurrency, ok := registry.byCode[defaultCode]
+	if !ok {
+		return nil, fmt.Errorf("default currency %q is not registered", defaultCode)
+	}
+	registry.Default = defaultCurrency
+	return registry, nil
+}
+
+// Lookup returns the currency with an ISO 4217 code, and false if it is not
+// registered.
+func (c *Currencies) Lookup(code string) (Currency, bool) {
+	currency, ok := c.byCode[strings.ToUpper(code)]
+	return currency, ok
+}
+
+// ForLedger returns the currency kept on a ledger, and false if there is none.
+func (c *Currencies) ForLedger(ledger uint32) (Currency, bool) {
+	currency, ok := c.byLedger[ledger]
+	return currency, ok
+}
+
+// All returns the registered currencies, ordered by code.
+func (c *Currencies) All() []Currency {
+	currencies := make([]Currency, 0, len(c.byCode))
+	for _, currency := range c.byCode {
+		currencies = append(currencies, currency)
+	}
+	sort.Slice(currencies, func(i, j int) bool {
+		return currencies[i].Code < currencies[j].Code
+	})
+	return currencies
+}
+
+// ConvertAmount converts an amount in minor units of from into minor units of
+// to at rate, the amount of to one unit of from buys, less a spread in basis
+// points, rounding down. The converted amount is at most MaxAmount.
+func ConvertAmount(amount uint64, from Currency, to Currency, rate *big.Rat, spreadBasisPoints uint64) (uint64, error) {
+	converted := new(big.Rat).SetUint64(amount)
+	converted.Mul(converted, rate)
+	converted.Mul(converted, big.NewRat(int64(10000-spreadBasisPoints), 10000))
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(to.Exponent-from.Exponent))), nil))
+	if to.Exponent > from.Exponent {
+		converted.Mul(converted, scale)
+	} else {
+		converted.Quo(converted, scale)
+	}
+	minor := new(big.Int).Quo(converted.Num(), converted.Denom())
+	switch {
+	case minor.Sign() == 0:
+		return 0, &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("Amount is too small to exchange for %s", to.Code)}
+	case !minor.IsUint64() || minor.Uint64() > MaxAmount:
+		return 0, &errs.Error{Code: errs.OutOfRange, Message: fmt.Sprintf("Amount is too large to exchange for %s", to.Code)}
+	}
+	return minor.Uint64(), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,53 @@
+package ledger
+
+import (
+	"encore.dev/beta/errs"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestConvertAmount(t *testing.T) {
+	eur := Currency{Code: "EUR", Ledger: 1, Exponent: 2}
+	usd := Currency{Code: "USD", Ledger: 2, Exponent: 2}
+	jpy := Currency{Code: "JPY", Ledger: 3, Exponent: 0}
+	tests := []struct {
+		name              string
+		amount            uint64
+		from, to          Currency
+		rate              string
+		spreadBasisPoints uint64
+		want              uint64
+		code              errs.ErrCode
+	}{
+		{name: "same exponent", amount: 10000, from: eur, to: usd, rate: "1.085", want: 10850},
+		{name: "spread", amount: 10000, from: eur, to: usd, rate: "1.085", spreadBasisPoints: 50, want: 10795},
+		{name: "rounds down", amount: 1, from: eur, to: usd, rate: "1.999", want: 1},
+		{name: "fewer decimals", amount: 10000, from: usd, to: jpy, rate: "149.5", want: 14950},
+		{name: "more decimals", amount: 14950, from: jpy, to: usd, rate: "2/299", want: 10000},
+		{name: "too small", amount: 1, from: usd, to: jpy, rate: "0.5", code: errs.InvalidArgument},
+		{name: "too large", amount: 1 << 63, from: eur, to: usd, rate: "2", code: errs.OutOfRange},
+		{name: "above the largest amount", amount: 1 << 62, from: eur, to: usd, rate: "2", code: errs.OutOfRange},
+		{name: "below the largest amount", amount: 1<<62 - 1, from: eur, to: usd, rate: "2", want: 1<<63 - 2},
+		{name: "whole spread", amount: 10000, from: eur, to: usd, rate: "1", spreadBasisPoints: 10000, code: errs.InvalidArgument},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rate, ok := new(big.Rat).SetString(test.rate)
+			if !ok {
+				t.Fatalf("invalid rate %s", test.rate)
+			}
+			got, err := ConvertAmount(test.amount, test.from, test.to, rate, test.spreadBasisPoints)
+			var apiErr *errs.Error
+			switch {
+			case test.code == errs.OK && err != nil:
+				t.Fatalf("got error %#v", err)
+			case test.code != errs.OK && (!errors.As(err, &apiErr) || apiErr.Code != test.code):
+				t.Fatalf("got error %#v, want code %v", err, test.code)
+			}
+			if got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
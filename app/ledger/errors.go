@@ -0,0 +1,114 @@
+package ledger
+
+import (
+	"encore.dev/beta/errs"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"strings"
+	"unicode"
+)
+
+// ResultDetails are the details of an error for a failed ledger result.
+// Reason is the TigerBeetle result name, e.g. "exceeds_credits".
+type ResultDetails struct {
+	Reason string
+}
+
+func (ResultDetails) ErrDetails() {}
+
+// TransferError is the API error for a failed create transfer result.
+func TransferError(result tbtypes.CreateTransferResult) *errs.Error {
+	reason := TransferReason(result)
+	return &errs.Error{
+		Code:    transferErrorCode(result),
+		Message: "transfer failed: " + reason,
+		Details: ResultDetails{Reason: reason},
+	}
+}
+
+// AccountError is the API error for a failed create account result.
+func AccountError(result tbtypes.CreateAccountResult) *errs.Error {
+	reason := AccountReason(result)
+	return &errs.Error{
+		Code:    accountErrorCode(result),
+		Message: "account creation failed: " + reason,
+		Details: ResultDetails{Reason: reason},
+	}
+}
+
+func TransferReason(result tbtypes.CreateTransferResult) string {
+	return snakeCase(strings.TrimPrefix(result.String(), "Transfer"))
+}
+
+func AccountReason(result tbtypes.CreateAccountResult) string {
+	return snakeCase(strings.TrimPrefix(result.String(), "Account"))
+}
+
+func transferErrorCode(result tbtypes.CreateTransferResult) errs.ErrCode {
+	switch result {
+	case tbtypes.TransferLinkedEventFailed:
+		return errs.Aborted
+	case tbtypes.TransferExists,
+		tbtypes.TransferExistsWithDifferentFlags,
+		tbtypes.TransferExistsWithDifferentDebitAccountID,
+		tbtypes.TransferExistsWithDifferentCreditAccountID,
+		tbtypes.TransferExistsWithDifferentUserData,
+		tbtypes.TransferExistsWithDifferentPendingID,
+		tbtypes.TransferExistsWithDifferentTimeout,
+		tbtypes.TransferExistsWithDifferentCode,
+		tbtypes.TransferExistsWithDifferentAmount:
+		return errs.AlreadyExists
+	case tbtypes.TransferDebitAccountNotFound,
+		tbtypes.TransferCreditAccountNotFound,
+		tbtypes.TransferPendingTransferNotFound:
+		return errs.NotFound
+	case tbtypes.TransferOverflowsDebitsPending,
+		tbtypes.TransferOverflowsCreditsPending,
+		tbtypes.TransferOverflowsDebitsPosted,
+		tbtypes.TransferOverflowsCreditsPosted,
+		tbtypes.TransferOverflowsDebits,
+		tbtypes.TransferOverflowsCredits,
+		tbtypes.TransferOverflowsTimeout:
+		return errs.OutOfRange
+	case tbtypes.TransferExceedsCredits,
+		tbtypes.TransferExceedsDebits,
+		tbtypes.TransferPendingTransferNotPending,
+		tbtypes.TransferExceedsPendingTransferAmount,
+		tbtypes.TransferPendingTransferAlreadyPosted,
+		tbtypes.TransferPendingTransferAlreadyVoided,
+		tbtypes.TransferPendingTransferExpired:
+		return errs.FailedPrecondition
+	}
+	return errs.InvalidArgument
+}
+
+func accountErrorCode(result tbtypes.CreateAccountResult) errs.ErrCode {
+	switch result {
+	case tbtypes.AccountLinkedEventFailed:
+		return errs.Aborted
+	case tbtypes.AccountExists,
+		tbtypes.AccountExistsWithDifferentFlags,
+		tbtypes.AccountExistsWithDifferentUserData,
+		tbtypes.AccountExistsWithDifferentLedger,
+		tbtypes.AccountExistsWithDifferentCode:
+		return errs.AlreadyExists
+	}
+	return errs.InvalidArgument
+}
+
+// snakeCase turns a result name like "DebitAccountIDMustNotBeZero" into the
+// name TigerBeetle documents, "debit_account_id_must_not_be_zero".
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			previousLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if previousLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package ledger
+
+import (
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+)
+
+// FxTransfer exchanges between accounts in different currencies as a linked
+// pair of transfers: the debit leg from the debit account to the FX liquidity
+// account of From, and the credit leg from the FX liquidity account of To to
+// the credit account.
+type FxTransfer struct {
+	DebitLegId      tbtypes.Uint128
+	CreditLegId     tbtypes.Uint128
+	DebitAccountId  tbtypes.Uint128
+	CreditAccountId tbtypes.Uint128
+	From            Currency
+	To              Currency
+	DebitAmount     uint64
+	CreditAmount    uint64
+}
+
+// NewFxTransfer is an FX transfer of amount whose legs have the IDs id returns
+// for 0 and 1, its CreditAmount is left to set once it is converted. id is
+// called once for each leg, so the IDs the transfer is recorded with are those
+// of the transfers created even if id generates new ones.
+func NewFxTransfer(id func(n uint64) tbtypes.Uint128, debitAccountId tbtypes.Uint128, creditAccountId tbtypes.Uint128, from Currency, to Currency, amount uint64) FxTransfer {
+	return FxTransfer{
+		DebitLegId:      id(0),
+		CreditLegId:     id(1),
+		DebitAccountId:  debitAccountId,
+		CreditAccountId: creditAccountId,
+		From:            from,
+		To:              to,
+		DebitAmount:     amount,
+	}
+}
+
+// Transfers are the legs of the transfer, the debit leg first.
+func (f FxTransfer) Transfers() []tbtypes.Transfer {
+	return []tbtypes.Transfer{
+		{
+			ID:              f.DebitLegId,
+			DebitAccountID:  f.DebitAccountId,
+			CreditAccountID: f.From.FxAccountId,
+			Amount:          f.DebitAmount,
+			Ledger:          f.From.Ledger,
+			Code:            TransferCode,
+			Flags:           tbtypes.TransferFlags{Linked: true}.ToUint16(),
+		},
+		{
+			ID:              f.CreditLegId,
+			DebitAccountID:  f.To.FxAccountId,
+			CreditAccountID: f.CreditAccountId,
+			Amount:          f.CreditAmount,
+			Ledger:          f.To.Ledger,
+			Code:            TransferCode,
+		},
+	}
+}
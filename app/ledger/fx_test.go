@@ -0,0 +1,53 @@
+package ledger
+
+import (
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"testing"
+)
+
+// TestFxTransferGeneratedIds creates an FX transfer with new IDs, as for a
+// request without an idempotency key, and finds both legs by the IDs it
+// records.
+func TestFxTransferGeneratedIds(t *testing.T) {
+	eur := Currency{Code: "EUR", Ledger: 1, Exponent: 2, FxAccountId: testId(101)}
+	usd := Currency{Code: "USD", Ledger: 2, Exponent: 2, FxAccountId: testId(102)}
+	m := NewMemory()
+	res, err := m.CreateAccounts([]tbtypes.Account{
+		{ID: testId(1), Ledger: eur.Ledger, Code: 1},
+		{ID: eur.FxAccountId, Ledger: eur.Ledger, Code: 1},
+		{ID: usd.FxAccountId, Ledger: usd.Ledger, Code: 1},
+		{ID: testId(2), Ledger: usd.Ledger, Code: 1},
+	})
+	if err != nil || len(res) != 0 {
+		t.Fatalf("creating accounts: %v, %v", res, err)
+	}
+
+	calls := 0
+	exchange := NewFxTransfer(func(uint64) tbtypes.Uint128 {
+		calls++
+		return NewId()
+	}, testId(1), testId(2), eur, usd, 10000)
+	exchange.CreditAmount = 10850
+	if calls != 2 {
+		t.Errorf("got %d IDs, want one per leg", calls)
+	}
+	transferRes, err := CreateTransfersOnce(m, exchange.Transfers())
+	if err != nil || len(transferRes) != 0 {
+		t.Fatalf("creating transfers: %v, %v", transferRes, err)
+	}
+
+	transfers, err := m.LookupTransfers([]tbtypes.Uint128{exchange.DebitLegId, exchange.CreditLegId})
+	if err != nil || len(transfers) != 2 {
+		t.Fatalf("looking up legs: %v, %v", transfers, err)
+	}
+	want := []tbtypes.Transfer{
+		{ID: exchange.DebitLegId, DebitAccountID: testId(1), CreditAccountID: eur.FxAccountId, Amount: 10000, Ledger: eur.Ledger},
+		{ID: exchange.CreditLegId, DebitAccountID: usd.FxAccountId, CreditAccountID: testId(2), Amount: 10850, Ledger: usd.Ledger},
+	}
+	for i, transfer := range transfers {
+		if transfer.ID != want[i].ID || transfer.DebitAccountID != want[i].DebitAccountID ||
+			transfer.CreditAccountID != want[i].CreditAccountID || transfer.Amount != want[i].Amount || transfer.Ledger != want[i].Ledger {
+			t.Errorf("leg %d: got %+v, want %+v", i, transfer, want[i])
+		}
+	}
+}
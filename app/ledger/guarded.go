@@ -0,0 +1,143 @@
+package ledger
+
+import (
+	"encore.dev/beta/errs"
+	"errors"
+	tberrors "github.com/tigerbeetledb/tigerbeetle-go/pkg/errors"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"sync"
+	"time"
+)
+
+// Guarded is a Ledger that fails with Unavailable errors when the ledger can't
+// be reached, see clientErrorCode for the client's errors. The TigerBeetle client waits for the cluster indefinitely, so
+// calls are given up on after a timeout. They are run by a fixed number of
+// workers rather than a goroutine each, so calls to a cluster that does not
+// respond pile up as callers waiting for a worker, which give up in turn,
+// instead of as requests in flight. A create that was given up on may still
+// happen, retrying it with the same IDs is safe, see CreateTransfersOnce.
+type Guarded struct {
+	ledger   Ledger
+	timeout  time.Duration
+	calls    chan func()
+	closed   chan struct{}
+	closeOne sync.Once
+}
+
+// NewGuarded guards l, giving up on calls after timeout. workers is how many
+// calls run at a time, the concurrency of the client.
+func NewGuarded(l Ledger, timeout time.Duration, workers uint) *Guarded {
+	g := &Guarded{
+		ledger:  l,
+		timeout: timeout,
+		calls:   make(chan func()),
+		closed:  make(chan struct{}),
+	}
+	if workers == 0 {
+		workers = 1
+	}
+	for i := uint(0); i < workers; i++ {
+		go g.work()
+	}
+	return g
+}
+
+func (g *Guarded) work() {
+	for {
+		select {
+		case call := <-g.calls:
+			call()
+		case <-g.closed:
+			return
+		}
+	}
+}
+
+func (g *Guarded) CreateAccounts(accounts []tbtypes.Account) ([]tbtypes.AccountEventResult, error) {
+	return guard(g, func() ([]tbtypes.AccountEventResult, error) {
+		return g.ledger.CreateAccounts(accounts)
+	})
+}
+
+func (g *Guarded) CreateTransfers(transfers []tbtypes.Transfer) ([]tbtypes.TransferEventResult, error) {
+	return guard(g, func() ([]tbtypes.TransferEventResult, error) {
+		return g.ledger.CreateTransfers(transfers)
+	})
+}
+
+func (g *Guarded) LookupAccounts(accountIds []tbtypes.Uint128) ([]tbtypes.Account, error) {
+	return guard(g, func() ([]tbtypes.Account, error) {
+		return g.ledger.LookupAccounts(accountIds)
+	})
+}
+
+func (g *Guarded) LookupTransfers(transferIds []tbtypes.Uint128) ([]tbtypes.Transfer, error) {
+	return guard(g, func() ([]tbtypes.Transfer, error) {
+		return g.ledger.LookupTransfers(transferIds)
+	})
+}
+
+func (g *Guarded) Close() {
+	g.closeOne.Do(func() {
+		close(g.closed)
+		g.ledger.Close()
+	})
+}
+
+// guard runs call on one of g's workers, failing if it does not get one or
+// does not complete within g's timeout.
+func guard[T any](g *Guarded, call func() ([]T, error)) ([]T, error) {
+	type result struct {
+		values []T
+		err    error
+	}
+	// Buffered, so that a worker finishing a call that was given up on does
+	// not block.
+	done := make(chan result, 1)
+	timer := time.NewTimer(g.timeout)
+	defer timer.Stop()
+
+	select {
+	case g.calls <- func() {
+		values, err := call()
+		done <- result{values, err}
+	}:
+	case <-g.closed:
+		return nil, &errs.Error{Code: errs.Unavailable, Message: "ledger client is closed"}
+	case <-timer.C:
+		return nil, &errs.Error{Code: errs.Unavailable, Message: "ledger is busy"}
+	}
+
+	select {
+	case r := <-done:
+		return r.values, clientError(r.err)
+	case <-timer.C:
+		return nil, &errs.Error{Code: errs.Unavailable, Message: "ledger did not respond"}
+	}
+}
+
+// clientError is the API error of an error of the ledger client, see
+// clientErrorCode.
+func clientError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return errs.WrapCode(err, clientErrorCode(err), "ledger request failed")
+}
+
+// clientErrorCode is Unavailable for the errors of a client that can't reach
+// the cluster, which may succeed when retried. Batches the client refuses are
+// InvalidArgument, and any other error Internal.
+func clientErrorCode(err error) errs.ErrCode {
+	switch {
+	case errors.As(err, &tberrors.ErrClientClosed{}),
+		errors.As(err, &tberrors.ErrNetworkSubsystem{}),
+		errors.As(err, &tberrors.ErrSystemResources{}),
+		errors.As(err, &tberrors.ErrOutOfMemory{}):
+		return errs.Unavailable
+	case errors.As(err, &tberrors.ErrEmptyBatch{}),
+		errors.As(err, &tberrors.ErrMaximumBatchSizeExceeded{}):
+		return errs.InvalidArgument
+	}
+	return errs.Internal
+}
@@ -0,0 +1,29 @@
+package ledger
+
+import (
+	"encore.dev/beta/errs"
+	"errors"
+	"fmt"
+	tberrors "github.com/tigerbeetledb/tigerbeetle-go/pkg/errors"
+	"testing"
+)
+
+func TestClientErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want errs.ErrCode
+	}{
+		{tberrors.ErrClientClosed{}, errs.Unavailable},
+		{tberrors.ErrNetworkSubsystem{}, errs.Unavailable},
+		{fmt.Errorf("lookup: %w", tberrors.ErrSystemResources{}), errs.Unavailable},
+		{tberrors.ErrEmptyBatch{}, errs.InvalidArgument},
+		{tberrors.ErrMaximumBatchSizeExceeded{}, errs.InvalidArgument},
+		{tberrors.ErrInvalidOperation{}, errs.Internal},
+		{errors.New("unknown"), errs.Internal},
+	}
+	for _, test := range tests {
+		if got := clientErrorCode(test.err); got != test.want {
+			t.Errorf("%T: got %v, want %v", test.err, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package ledger
+
+import (
+	"crypto/rand"
+	"errors"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DecimalIdPrefix marks an ID given in decimal rather than hex.
+const DecimalIdPrefix = "dec:"
+
+var (
+	errIdEmpty    = errors.New("must not be empty")
+	errIdReserved = errors.New("is reserved")
+	errIdInvalid  = errors.New("must be up to 32 hex digits, a UUID or " + DecimalIdPrefix + " followed by a decimal number")
+	errIdTooLarge = errors.New("does not fit in 128 bits")
+)
+
+// idGenerator generates ULID-style IDs: the high 48 bits are the time in
+// milliseconds and the low 80 bits are random. IDs from different workers sort
+// by time and are vanishingly unlikely to collide. Within a process, IDs in the
+// same millisecond increment the random bits of the last one, so they stay
+// ordered even if the clock goes backwards.
+type idGenerator struct {
+	mu     sync.Mutex
+	ms     uint64
+	random [10]byte
+}
+
+var ids idGenerator
+
+// NewId returns a new, time-ordered ID for a transfer or account.
+func NewId() tbtypes.Uint128 {
+	return ids.next(time.Now())
+}
+
+func (g *idGenerator) next(now time.Time) tbtypes.Uint128 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if ms := uint64(now.UnixMilli()); ms > g.ms {
+		g.ms = ms
+		if _, err := rand.Read(g.random[:]); err != nil {
+			panic("ledger: could not read random bytes for ID: " + err.Error())
+		}
+	} else if g.increment() {
+		g.ms++
+	}
+
+	// Uint128 is little-endian.
+	var id [16]byte
+	for i, b := range g.random {
+		id[len(g.random)-1-i] = b
+	}
+	for i := 0; i < 6; i++ {
+		id[len(g.random)+i] = byte(g.ms >> (8 * i))
+	}
+	return tbtypes.BytesToUint128(id)
+}
+
+// increment adds one to the random bits, reporting whether they overflowed.
+func (g *idGenerator) increment() bool {
+	for i := len(g.random) - 1; i >= 0; i-- {
+		g.random[i]++
+		if g.random[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NthId returns id plus n, for a number of IDs derived from a hash. It is not
+// for IDs from NewId: those generated in the same millisecond are consecutive,
+// so the IDs after one may be generated for another transfer.
+func NthId(id tbtypes.Uint128, n uint64) tbtypes.Uint128 {
+	// Uint128 is little-endian.
+	bytes := id.Bytes()
+	carry := n
+	for i := 0; i < len(bytes) && carry != 0; i++ {
+		sum := uint64(bytes[i]) + carry&0xff
+		bytes[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	return tbtypes.BytesToUint128(bytes)
+}
+
+// ParseId parses an account or transfer ID. IDs are hex, as the service
+// returns them, with an optional 0x prefix. UUIDs map to the 128-bit number
+// they encode, and decimal IDs are prefixed with DecimalIdPrefix. Zero and
+// the largest ID are reserved by the ledger and rejected.
+func ParseId(value string) (tbtypes.Uint128, error) {
+	var digits string
+	base := 16
+	switch {
+	case value == "":
+		return tbtypes.Uint128{}, errIdEmpty
+	case strings.HasPrefix(value, DecimalIdPrefix):
+		digits, base = strings.TrimPrefix(value, DecimalIdPrefix), 10
+	case len(value) == 36 && strings.Count(value, "-") == 4 &&
+		value[8] == '-' && value[13] == '-' && value[18] == '-' && value[23] == '-':
+		digits = strings.ReplaceAll(value, "-", "")
+	default:
+		digits = strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X")
+		if len(digits) > 32 {
+			return tbtypes.Uint128{}, errIdTooLarge
+		}
+	}
+
+	n, ok := new(big.Int).SetString(digits, base)
+	if digits == "" || !ok || strings.ContainsAny(digits, "+-_") {
+		return tbtypes.Uint128{}, errIdInvalid
+	}
+	if n.BitLen() > 128 {
+		return tbtypes.Uint128{}, errIdTooLarge
+	}
+
+	// Uint128 is little-endian, big.Int bytes are big-endian.
+	var bytes [16]byte
+	for i, b := range n.Bytes() {
+		bytes[len(n.Bytes())-1-i] = b
+	}
+	id := tbtypes.BytesToUint128(bytes)
+	if id == zeroId || id == maxId {
+		return tbtypes.Uint128{}, errIdReserved
+	}
+	return id, nil
+}
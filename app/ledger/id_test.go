@@ -0,0 +1,125 @@
+package ledger
+
+import (
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// idInt is the number an ID encodes.
+func idInt(id tbtypes.Uint128) *big.Int {
+	bytes := id.Bytes()
+	for i, j := 0, len(bytes)-1; i < j; i, j = i+1, j-1 {
+		bytes[i], bytes[j] = bytes[j], bytes[i]
+	}
+	return new(big.Int).SetBytes(bytes[:])
+}
+
+func TestParseId(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   error
+	}{
+		{value: "1f", want: "1f"},
+		{value: "0x1F", want: "1f"},
+		{value: "0X1f", want: "1f"},
+		{value: "fffffffffffffffffffffffffffffffe", want: "fffffffffffffffffffffffffffffffe"},
+		{value: "00000000-0000-0000-0000-00000000001f", want: "1f"},
+		{value: "123e4567-e89b-12d3-a456-426614174000", want: "123e4567e89b12d3a456426614174000"},
+		{value: DecimalIdPrefix + "31", want: "1f"},
+		{value: "", err: errIdEmpty},
+		{value: "0", err: errIdReserved},
+		{value: "0x0", err: errIdReserved},
+		{value: "ffffffffffffffffffffffffffffffff", err: errIdReserved},
+		{value: DecimalIdPrefix + "340282366920938463463374607431768211455", err: errIdReserved},
+		{value: "1ffffffffffffffffffffffffffffffff", err: errIdTooLarge},
+		{value: DecimalIdPrefix + "340282366920938463463374607431768211456", err: errIdTooLarge},
+		{value: "0x", err: errIdInvalid},
+		{value: "xyz", err: errIdInvalid},
+		{value: "+1", err: errIdInvalid},
+		{value: "1_0", err: errIdInvalid},
+		{value: DecimalIdPrefix, err: errIdInvalid},
+		{value: DecimalIdPrefix + "-1", err: errIdInvalid},
+		{value: DecimalIdPrefix + "1f", err: errIdInvalid},
+		{value: "123e4567-e89b-12d3-a456-42661417400g", err: errIdInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			id, err := ParseId(test.value)
+			if err != test.err {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if err == nil && id.String() != test.want {
+				t.Errorf("got %s, want %s", id, test.want)
+			}
+		})
+	}
+}
+
+func TestNewId(t *testing.T) {
+	id := NewId()
+	parsed, err := ParseId(id.String())
+	if err != nil || parsed != id {
+		t.Errorf("ParseId(%s) = %s, %v", id, parsed, err)
+	}
+	if ms := new(big.Int).Rsh(idInt(id), 80).Int64(); time.Since(time.UnixMilli(ms)) > time.Minute {
+		t.Errorf("id %s has time %v", id, time.UnixMilli(ms))
+	}
+}
+
+func TestIdGeneratorOrder(t *testing.T) {
+	var g idGenerator
+	start := time.UnixMilli(1_700_000_000_000)
+	times := []time.Time{
+		start,
+		start,
+		start.Add(time.Millisecond),
+		// The clock going backwards still gives larger IDs.
+		start,
+		start.Add(-time.Second),
+	}
+	previous := g.next(times[0])
+	for i, now := range times[1:] {
+		id := g.next(now)
+		if idInt(id).Cmp(idInt(previous)) <= 0 {
+			t.Errorf("id %d: %s is not after %s", i+1, id, previous)
+		}
+		previous = id
+	}
+}
+
+func TestIdGeneratorOverflow(t *testing.T) {
+	g := idGenerator{ms: 1000}
+	for i := range g.random {
+		g.random[i] = 0xff
+	}
+	id := g.next(time.UnixMilli(1000))
+	if ms := new(big.Int).Rsh(idInt(id), 80).Uint64(); ms != 1001 {
+		t.Errorf("got time %d, want 1001", ms)
+	}
+}
+
+func TestNthId(t *testing.T) {
+	tests := []struct {
+		id   string
+		n    uint64
+		want string
+	}{
+		{"1ff", 0, "1ff"},
+		{"1ff", 1, "200"},
+		{"1ff", 0x10001, "10200"},
+		{"ffffffffffffffff", 1, "10000000000000000"},
+		{"ff", 0xffffffffffffffff, "100000000000000fe"},
+	}
+	for _, test := range tests {
+		id, err := ParseId(test.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := NthId(id, test.n).String(); got != test.want {
+			t.Errorf("NthId(%s, %#x) = %s, want %s", test.id, test.n, got, test.want)
+		}
+	}
+}
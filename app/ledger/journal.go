@@ -0,0 +1,224 @@
+package ledger
+
+import (
+	"context"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	TransferStatusPending = "pending"
+	TransferStatusPosted  = "posted"
+	TransferStatusVoided  = "voided"
+	TransferStatusExpired = "expired"
+
+	DirectionDebit  = "debit"
+	DirectionCredit = "credit"
+)
+
+// Journal records the transfers created through the service. The ledger can
+// only look transfers up by ID, the journal answers what it can't, such as
+// which transfer posted or voided a pending transfer.
+type Journal interface {
+	RecordTransfers(ctx context.Context, transfers []tbtypes.Transfer) error
+	// LookupResolution returns the transfer that posted or voided a pending
+	// transfer, and false if it has not been posted or voided.
+	LookupResolution(ctx context.Context, pendingId tbtypes.Uint128) (tbtypes.Transfer, bool, error)
+	// ListTransfers returns the transfers matching query, most recent first.
+	ListTransfers(ctx context.Context, query TransferQuery) ([]JournalEntry, error)
+}
+
+// TransferQuery selects the transfers of an account in a journal.
+type TransferQuery struct {
+	AccountId tbtypes.Uint128
+	// Direction is DirectionDebit or DirectionCredit for only the transfers
+	// debiting or crediting the account, or empty for both.
+	Direction string
+	// From and To bound the transfers' ledger timestamps, From inclusive and To
+	// exclusive. Zero is unbounded.
+	From uint64
+	To   uint64
+	// Before, if set, only returns transfers before the one with
+	// BeforeTimestamp and BeforeId, to page through the results.
+	Before          bool
+	BeforeTimestamp uint64
+	BeforeId        tbtypes.Uint128
+	Limit           int
+}
+
+// JournalEntry is a transfer in a journal. Resolution is the transfer that
+// posted or voided it, for pending transfers that have been.
+type JournalEntry struct {
+	Transfer   tbtypes.Transfer
+	Resolution *tbtypes.Transfer
+}
+
+// before orders entries most recent first.
+func (e JournalEntry) before(timestamp uint64, id tbtypes.Uint128) bool {
+	if e.Transfer.Timestamp != timestamp {
+		return e.Transfer.Timestamp < timestamp
+	}
+	return compareIds(e.Transfer.ID, id) < 0
+}
+
+func compareIds(a tbtypes.Uint128, b tbtypes.Uint128) int {
+	x, y := a.Bytes(), b.Bytes()
+	for i := len(x) - 1; i >= 0; i-- {
+		switch {
+		case x[i] < y[i]:
+			return -1
+		case x[i] > y[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// matches reports whether the query selects transfer, ignoring Before and
+// Limit.
+func (q TransferQuery) matches(transfer tbtypes.Transfer) bool {
+	debit, credit := transfer.DebitAccountID == q.AccountId, transfer.CreditAccountID == q.AccountId
+	switch {
+	case q.Direction == DirectionDebit && !debit,
+		q.Direction == DirectionCredit && !credit,
+		!debit && !credit:
+		return false
+	case q.From != 0 && transfer.Timestamp < q.From,
+		q.To != 0 && transfer.Timestamp >= q.To:
+		return false
+	}
+	return true
+}
+
+// Journaled is a Ledger that records the transfers it creates in a Journal.
+type Journaled struct {
+	Ledger
+	Journal Journal
+}
+
+func (j *Journaled) CreateTransfers(transfers []tbtypes.Transfer) ([]tbtypes.TransferEventResult, error) {
+	res, err := j.Ledger.CreateTransfers(transfers)
+	if err != nil {
+		return res, err
+	}
+	// Transfers that already exist are recorded again, in case recording them
+	// failed when they were created.
+	failed := map[uint32]bool{}
+	for _, r := range res {
+		failed[r.Index] = r.Result != tbtypes.TransferExists
+	}
+	var created []tbtypes.Transfer
+	var createdIds []tbtypes.Uint128
+	for i, transfer := range transfers {
+		if !failed[uint32(i)] {
+			created = append(created, transfer)
+			createdIds = append(createdIds, transfer.ID)
+		}
+	}
+	if len(created) > 0 {
+		// The ledger sets the timestamp, and the accounts of posts and voids.
+		stored, err := j.Ledger.LookupTransfers(createdIds)
+		if err == nil && len(stored) == len(created) {
+			created = stored
+		} else {
+			log.Printf("Could not look up %d created transfers, journaling them as requested: %v", len(created), err)
+			now := uint64(time.Now().UnixNano())
+			for i := range created {
+				created[i].Timestamp = now
+			}
+		}
+		err = j.Journal.RecordTransfers(context.Background(), created)
+		if err != nil {
+			log.Printf("Could not record %d transfers in the journal: %s", len(created), err)
+		}
+	}
+	return res, nil
+}
+
+// TransferStatus is the status of a transfer: pending, posted, voided or
+// expired. resolution is the transfer that posted or voided it, if any.
+func TransferStatus(transfer tbtypes.Transfer, resolution *tbtypes.Transfer) string {
+	flags := DecodeTransferFlags(transfer.Flags)
+	switch {
+	case flags.VoidPendingTransfer:
+		return TransferStatusVoided
+	case !flags.Pending:
+		return TransferStatusPosted
+	case resolution != nil && DecodeTransferFlags(resolution.Flags).VoidPendingTransfer:
+		return TransferStatusVoided
+	case resolution != nil:
+		return TransferStatusPosted
+	case transfer.Timeout != 0 && transfer.Timestamp+transfer.Timeout <= uint64(time.Now().UnixNano()):
+		return TransferStatusExpired
+	}
+	return TransferStatusPending
+}
+
+// MemoryJournal is the Journal of the in-memory ledger.
+type MemoryJournal struct {
+	mu          sync.Mutex
+	transfers   map[tbtypes.Uint128]tbtypes.Transfer
+	resolutions map[tbtypes.Uint128]tbtypes.Uint128
+}
+
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{
+		transfers:   map[tbtypes.Uint128]tbtypes.Transfer{},
+		resolutions: map[tbtypes.Uint128]tbtypes.Uint128{},
+	}
+}
+
+func (m *MemoryJournal) RecordTransfers(_ context.Context, transfers []tbtypes.Transfer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, transfer := range transfers {
+		if _, ok := m.transfers[transfer.ID]; ok {
+			continue
+		}
+		m.transfers[transfer.ID] = transfer
+		if transfer.PendingID != zeroId {
+			m.resolutions[transfer.PendingID] = transfer.ID
+		}
+	}
+	return nil
+}
+
+func (m *MemoryJournal) ListTransfers(_ context.Context, query TransferQuery) ([]JournalEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []JournalEntry
+	for _, transfer := range m.transfers {
+		if !query.matches(transfer) {
+			continue
+		}
+		entry := JournalEntry{Transfer: transfer}
+		if query.Before && !entry.before(query.BeforeTimestamp, query.BeforeId) {
+			continue
+		}
+		if id, ok := m.resolutions[transfer.ID]; ok {
+			resolution := m.transfers[id]
+			entry.Resolution = &resolution
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[j].before(entries[i].Transfer.Timestamp, entries[i].Transfer.ID)
+	})
+	if query.Limit > 0 && len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+	}
+	return entries, nil
+}
+
+func (m *MemoryJournal) LookupResolution(_ context.Context, pendingId tbtypes.Uint128) (tbtypes.Transfer, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.resolutions[pendingId]
+	if !ok {
+		return tbtypes.Transfer{}, false, nil
+	}
+	return m.transfers[id], true, nil
+}
@@ -0,0 +1,193 @@
+package ledger
+
+import (
+	"context"
+	"encore.dev/storage/sqldb"
+	"fmt"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"strings"
+)
+
+// SqlJournal keeps the journal in the service's Postgres database, see
+// app/migrations.
+type SqlJournal struct{}
+
+// transferColumns are the columns scanned by transferRow.
+const transferColumns = `transfer_id, debit_account_id, credit_account_id, amount, pending_id, user_data,
+	timeout, ledger, code, flags, timestamp`
+
+func (SqlJournal) RecordTransfers(ctx context.Context, transfers []tbtypes.Transfer) error {
+	tx, err := sqldb.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range transfers {
+		var pendingId *string
+		if t.PendingID != zeroId {
+			id := t.PendingID.String()
+			pendingId = &id
+		}
+		_, err = sqldb.ExecTx(tx, ctx, `
+			INSERT INTO transfer_journal (`+transferColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (transfer_id) DO NOTHING
+		`, t.ID.String(), t.DebitAccountID.String(), t.CreditAccountID.String(), int64(t.Amount),
+			pendingId, t.UserData.String(), int64(t.Timeout), int64(t.Ledger), int(t.Code), int(t.Flags),
+			int64(t.Timestamp))
+		if err != nil {
+			_ = sqldb.Rollback(tx)
+			return err
+		}
+	}
+	return sqldb.Commit(tx)
+}
+
+func (SqlJournal) LookupResolution(ctx context.Context, pendingId tbtypes.Uint128) (tbtypes.Transfer, bool, error) {
+	transfer, err := scanTransfer(sqldb.QueryRow(ctx, `
+		SELECT `+transferColumns+`
+		FROM transfer_journal
+		WHERE pending_id = $1
+		ORDER BY created_at
+		LIMIT 1
+	`, pendingId.String()))
+	if err == sqldb.ErrNoRows {
+		return tbtypes.Transfer{}, false, nil
+	}
+	if err != nil {
+		return tbtypes.Transfer{}, false, err
+	}
+	return transfer, true, nil
+}
+
+func (SqlJournal) ListTransfers(ctx context.Context, query TransferQuery) ([]JournalEntry, error) {
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	accountId := arg(query.AccountId.String())
+	switch query.Direction {
+	case DirectionDebit:
+		conditions = append(conditions, "t.debit_account_id = "+accountId)
+	case DirectionCredit:
+		conditions = append(conditions, "t.credit_account_id = "+accountId)
+	default:
+		conditions = append(conditions, "(t.debit_account_id = "+accountId+" OR t.credit_account_id = "+accountId+")")
+	}
+	if query.From != 0 {
+		conditions = append(conditions, "t.timestamp >= "+arg(int64(query.From)))
+	}
+	if query.To != 0 {
+		conditions = append(conditions, "t.timestamp < "+arg(int64(query.To)))
+	}
+	if query.Before {
+		beforeId := query.BeforeId.String()
+		conditions = append(conditions, fmt.Sprintf("(t.timestamp, length(t.transfer_id), t.transfer_id) < (%s, %s, %s)",
+			arg(int64(query.BeforeTimestamp)), arg(len(beforeId)), arg(beforeId)))
+	}
+	limit := ""
+	if query.Limit > 0 {
+		limit = "LIMIT " + arg(query.Limit)
+	}
+
+	prefixed := func(alias string) string {
+		columns := strings.Split(transferColumns, ",")
+		for i, column := range columns {
+			columns[i] = alias + "." + strings.TrimSpace(column)
+		}
+		return strings.Join(columns, ", ")
+	}
+	// IDs are unpadded hex, ordering them by length first orders them by value.
+	rows, err := sqldb.Query(ctx, `
+		SELECT `+prefixed("t")+`, r.transfer_id IS NOT NULL, `+prefixed("r")+`
+		FROM transfer_journal t
+		LEFT JOIN LATERAL (
+			SELECT * FROM transfer_journal
+			WHERE pending_id = t.transfer_id
+			ORDER BY created_at
+			LIMIT 1
+		) r ON true
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY t.timestamp DESC, length(t.transfer_id) DESC, t.transfer_id DESC
+		`+limit, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []JournalEntry
+	for rows.Next() {
+		var transfer, resolution transferRow
+		var resolved bool
+		dest := append(transfer.dest(), &resolved)
+		err = rows.Scan(append(dest, resolution.dest()...)...)
+		if err != nil {
+			return nil, err
+		}
+		entry := JournalEntry{Transfer: transfer.transfer()}
+		if resolved {
+			resolvedBy := resolution.transfer()
+			entry.Resolution = &resolvedBy
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// transferRow scans the transferColumns of a row, which are all NULL for a
+// resolution that was not joined.
+type transferRow struct {
+	id, debitAccountId, creditAccountId, pendingId, userData *string
+	amount, timeout, ledger, timestamp                       *int64
+	code, flags                                              *int
+}
+
+func (r *transferRow) dest() []interface{} {
+	return []interface{}{&r.id, &r.debitAccountId, &r.creditAccountId, &r.amount, &r.pendingId, &r.userData,
+		&r.timeout, &r.ledger, &r.code, &r.flags, &r.timestamp}
+}
+
+func (r *transferRow) transfer() tbtypes.Transfer {
+	id := func(value *string) tbtypes.Uint128 {
+		if value == nil {
+			return zeroId
+		}
+		parsed, _ := tbtypes.HexStringToUint128(*value)
+		return parsed
+	}
+	number := func(value *int64) int64 {
+		if value == nil {
+			return 0
+		}
+		return *value
+	}
+	small := func(value *int) int {
+		if value == nil {
+			return 0
+		}
+		return *value
+	}
+	return tbtypes.Transfer{
+		ID:              id(r.id),
+		DebitAccountID:  id(r.debitAccountId),
+		CreditAccountID: id(r.creditAccountId),
+		UserData:        id(r.userData),
+		PendingID:       id(r.pendingId),
+		Timeout:         uint64(number(r.timeout)),
+		Ledger:          uint32(number(r.ledger)),
+		Code:            uint16(small(r.code)),
+		Flags:           uint16(small(r.flags)),
+		Amount:          uint64(number(r.amount)),
+		Timestamp:       uint64(number(r.timestamp)),
+	}
+}
+
+func scanTransfer(row *sqldb.Row) (tbtypes.Transfer, error) {
+	var r transferRow
+	err := row.Scan(r.dest()...)
+	if err != nil {
+		return tbtypes.Transfer{}, err
+	}
+	return r.transfer(), nil
+}
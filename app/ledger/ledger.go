@@ -0,0 +1,124 @@
+package ledger
+
+import (
+	tb "github.com/tigerbeetledb/tigerbeetle-go"
+	tberrors "github.com/tigerbeetledb/tigerbeetle-go/pkg/errors"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"math"
+)
+
+const (
+	BackendTigerBeetle = "tigerbeetle"
+	BackendMemory      = "memory"
+
+	// MaxBatchSize is the number of accounts or transfers that fit in a single
+	// TigerBeetle request.
+	MaxBatchSize = 8191
+
+	// TransferCode is the code of the transfers the service creates.
+	TransferCode = 1
+
+	// MaxAmount is the largest amount the service accepts, the largest that
+	// fits the BIGINT columns amounts are stored in.
+	MaxAmount = math.MaxInt64
+)
+
+// Ledger is the subset of the TigerBeetle client used by the service. Like
+// TigerBeetle, CreateAccounts and CreateTransfers only return results for
+// events that failed.
+type Ledger interface {
+	CreateAccounts(accounts []tbtypes.Account) ([]tbtypes.AccountEventResult, error)
+	CreateTransfers(transfers []tbtypes.Transfer) ([]tbtypes.TransferEventResult, error)
+	LookupAccounts(accountIds []tbtypes.Uint128) ([]tbtypes.Account, error)
+	LookupTransfers(transferIds []tbtypes.Uint128) ([]tbtypes.Transfer, error)
+	Close()
+}
+
+// CreateTransfersOnce creates transfers in the ledger, treating transfers that
+// already exist as created so that requests creating transfers with the same
+// IDs can be retried. Linked chains are created atomically, so a chain that
+// failed because one of its transfers exists was created in full by an
+// earlier attempt and its results are dropped too.
+func CreateTransfersOnce(l Ledger, transfers []tbtypes.Transfer) ([]tbtypes.TransferEventResult, error) {
+	res, err := l.CreateTransfers(transfers)
+	if err != nil {
+		return nil, err
+	}
+	linkedFlag := tbtypes.TransferFlags{Linked: true}.ToUint16()
+	chainStart := make([]int, len(transfers))
+	existingChains := map[int]bool{}
+	start := 0
+	for i, transfer := range transfers {
+		chainStart[i] = start
+		if transfer.Flags&linkedFlag == 0 {
+			start = i + 1
+		}
+	}
+	for _, r := range res {
+		if r.Result == tbtypes.TransferExists {
+			existingChains[chainStart[r.Index]] = true
+		}
+	}
+	var failed []tbtypes.TransferEventResult
+	for _, r := range res {
+		if !existingChains[chainStart[r.Index]] {
+			failed = append(failed, r)
+		}
+	}
+	return failed, nil
+}
+
+type TigerBeetle struct {
+	client tb.Client
+}
+
+func NewTigerBeetle(clusterId uint32, addresses []string, concurrency uint) (*TigerBeetle, error) {
+	client, err := tb.NewClient(clusterId, addresses, concurrency)
+	if err != nil {
+		return nil, err
+	}
+	return &TigerBeetle{client: client}, nil
+}
+
+func (t *TigerBeetle) CreateAccounts(accounts []tbtypes.Account) ([]tbtypes.AccountEventResult, error) {
+	if len(accounts) == 0 {
+		// The client indexes the first element before checking the batch size.
+		return nil, tberrors.ErrEmptyBatch{}
+	}
+	return t.client.CreateAccounts(accounts)
+}
+
+func (t *TigerBeetle) CreateTransfers(transfers []tbtypes.Transfer) ([]tbtypes.TransferEventResult, error) {
+	if len(transfers) == 0 {
+		return nil, tberrors.ErrEmptyBatch{}
+	}
+	return t.client.CreateTransfers(transfers)
+}
+
+func (t *TigerBeetle) LookupAccounts(accountIds []tbtypes.Uint128) ([]tbtypes.Account, error) {
+	if len(accountIds) == 0 {
+		return nil, tberrors.ErrEmptyBatch{}
+	}
+	return t.client.LookupAccounts(accountIds)
+}
+
+func (t *TigerBeetle) LookupTransfers(transferIds []tbtypes.Uint128) ([]tbtypes.Transfer, error) {
+	if len(transferIds) == 0 {
+		return nil, tberrors.ErrEmptyBatch{}
+	}
+	return t.client.LookupTransfers(transferIds)
+}
+
+func (t *TigerBeetle) Close() {
+	t.client.Close()
+}
+
+// DecodeTransferFlags is the inverse of TransferFlags.ToUint16.
+func DecodeTransferFlags(flags uint16) tbtypes.TransferFlags {
+	return tbtypes.TransferFlags{
+		Linked:              flags&tbtypes.TransferFlags{Linked: true}.ToUint16() != 0,
+		Pending:             flags&tbtypes.TransferFlags{Pending: true}.ToUint16() != 0,
+		PostPendingTransfer: flags&tbtypes.TransferFlags{PostPendingTransfer: true}.ToUint16() != 0,
+		VoidPendingTransfer: flags&tbtypes.TransferFlags{VoidPendingTransfer: true}.ToUint16() != 0,
+	}
+}
@@ -0,0 +1,571 @@
+package ledger
+
+import (
+	tberrors "github.com/tigerbeetledb/tigerbeetle-go/pkg/errors"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	accountFlagsMask  = 1<<3 - 1
+	transferFlagsMask = 1<<4 - 1
+)
+
+var (
+	zeroId tbtypes.Uint128
+	maxId  = tbtypes.BytesToUint128([16]byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	})
+)
+
+type pendingState int
+
+const (
+	pendingOpen pendingState = iota
+	pendingPosted
+	pendingVoided
+)
+
+// Memory is an in-process Ledger that follows TigerBeetle's validation order,
+// result codes, balance flags, linked chains and two-phase transfer semantics.
+// Like the TigerBeetle release the service is built against, a pending transfer
+// can't be posted or voided once its timeout has elapsed, but the amount it
+// holds is not released.
+type Memory struct {
+	mu        sync.Mutex
+	closed    bool
+	timestamp uint64
+	accounts  map[tbtypes.Uint128]tbtypes.Account
+	transfers map[tbtypes.Uint128]tbtypes.Transfer
+	pending   map[tbtypes.Uint128]pendingState
+
+	undo *undoLog
+}
+
+// undoLog records what a linked chain changed so it can be rolled back when an
+// event later in the chain fails.
+type undoLog struct {
+	accounts  map[tbtypes.Uint128]*tbtypes.Account
+	transfers []tbtypes.Uint128
+	pending   map[tbtypes.Uint128]*pendingState
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		accounts:  map[tbtypes.Uint128]tbtypes.Account{},
+		transfers: map[tbtypes.Uint128]tbtypes.Transfer{},
+		pending:   map[tbtypes.Uint128]pendingState{},
+	}
+}
+
+func (m *Memory) CreateAccounts(accounts []tbtypes.Account) ([]tbtypes.AccountEventResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkBatch(len(accounts)); err != nil {
+		return nil, err
+	}
+
+	var results []tbtypes.AccountEventResult
+	chain, chainBroken := -1, false
+	for i, a := range accounts {
+		linked := tbtypes.AccountFlags{Linked: true}.ToUint16()&a.Flags != 0
+		result := tbtypes.AccountOK
+		if linked && chain < 0 {
+			chain = i
+			m.undo = newUndoLog()
+		}
+		switch {
+		case chainBroken:
+			result = tbtypes.AccountLinkedEventFailed
+		case linked && i == len(accounts)-1:
+			result = tbtypes.AccountLinkedEventChainOpen
+		default:
+			result = m.createAccount(a)
+		}
+		if result != tbtypes.AccountOK {
+			if chain >= 0 && !chainBroken {
+				chainBroken = true
+				m.rollback()
+				for j := chain; j < i; j++ {
+					results = append(results, tbtypes.AccountEventResult{Index: uint32(j), Result: tbtypes.AccountLinkedEventFailed})
+				}
+			}
+			results = append(results, tbtypes.AccountEventResult{Index: uint32(i), Result: result})
+		}
+		if chain >= 0 && (!linked || i == len(accounts)-1) {
+			chain, chainBroken = -1, false
+			m.undo = nil
+		}
+	}
+	return results, nil
+}
+
+func (m *Memory) CreateTransfers(transfers []tbtypes.Transfer) ([]tbtypes.TransferEventResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkBatch(len(transfers)); err != nil {
+		return nil, err
+	}
+
+	var results []tbtypes.TransferEventResult
+	chain, chainBroken := -1, false
+	for i, t := range transfers {
+		linked := tbtypes.TransferFlags{Linked: true}.ToUint16()&t.Flags != 0
+		result := tbtypes.TransferOK
+		if linked && chain < 0 {
+			chain = i
+			m.undo = newUndoLog()
+		}
+		switch {
+		case chainBroken:
+			result = tbtypes.TransferLinkedEventFailed
+		case linked && i == len(transfers)-1:
+			result = tbtypes.TransferLinkedEventChainOpen
+		default:
+			result = m.createTransfer(t)
+		}
+		if result != tbtypes.TransferOK {
+			if chain >= 0 && !chainBroken {
+				chainBroken = true
+				m.rollback()
+				for j := chain; j < i; j++ {
+					results = append(results, tbtypes.TransferEventResult{Index: uint32(j), Result: tbtypes.TransferLinkedEventFailed})
+				}
+			}
+			results = append(results, tbtypes.TransferEventResult{Index: uint32(i), Result: result})
+		}
+		if chain >= 0 && (!linked || i == len(transfers)-1) {
+			chain, chainBroken = -1, false
+			m.undo = nil
+		}
+	}
+	return results, nil
+}
+
+func (m *Memory) LookupAccounts(accountIds []tbtypes.Uint128) ([]tbtypes.Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkBatch(len(accountIds)); err != nil {
+		return nil, err
+	}
+
+	var accounts []tbtypes.Account
+	for _, id := range accountIds {
+		if a, ok := m.accounts[id]; ok {
+			accounts = append(accounts, a)
+		}
+	}
+	return accounts, nil
+}
+
+func (m *Memory) LookupTransfers(transferIds []tbtypes.Uint128) ([]tbtypes.Transfer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkBatch(len(transferIds)); err != nil {
+		return nil, err
+	}
+
+	var transfers []tbtypes.Transfer
+	for _, id := range transferIds {
+		if t, ok := m.transfers[id]; ok {
+			transfers = append(transfers, t)
+		}
+	}
+	return transfers, nil
+}
+
+func (m *Memory) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+}
+
+func (m *Memory) checkBatch(size int) error {
+	if m.closed {
+		return tberrors.ErrClientClosed{}
+	}
+	if size == 0 {
+		return tberrors.ErrEmptyBatch{}
+	}
+	if size > MaxBatchSize {
+		return tberrors.ErrMaximumBatchSizeExceeded{}
+	}
+	return nil
+}
+
+func (m *Memory) nextTimestamp() uint64 {
+	now := uint64(time.Now().UnixNano())
+	if now <= m.timestamp {
+		now = m.timestamp + 1
+	}
+	m.timestamp = now
+	return now
+}
+
+func (m *Memory) createAccount(a tbtypes.Account) tbtypes.CreateAccountResult {
+	if a.Timestamp != 0 {
+		return tbtypes.AccountTimestampMustBeZero
+	}
+	if a.Flags&^accountFlagsMask != 0 {
+		return tbtypes.AccountReservedFlag
+	}
+	if a.Reserved != [48]uint8{} {
+		return tbtypes.AccountReservedField
+	}
+	if a.ID == zeroId {
+		return tbtypes.AccountIDMustNotBeZero
+	}
+	if a.ID == maxId {
+		return tbtypes.AccountIDMustNotBeIntMax
+	}
+	exclusive := tbtypes.AccountFlags{DebitsMustNotExceedCredits: true, CreditsMustNotExceedDebits: true}.ToUint16()
+	if a.Flags&exclusive == exclusive {
+		return tbtypes.AccountMutuallyExclusiveFlags
+	}
+	if a.Ledger == 0 {
+		return tbtypes.AccountLedgerMustNotBeZero
+	}
+	if a.Code == 0 {
+		return tbtypes.AccountCodeMustNotBeZero
+	}
+	if a.DebitsPending != 0 {
+		return tbtypes.AccountDebitsPendingMustBeZero
+	}
+	if a.DebitsPosted != 0 {
+		return tbtypes.AccountDebitsPostedMustBeZero
+	}
+	if a.CreditsPending != 0 {
+		return tbtypes.AccountCreditsPendingMustBeZero
+	}
+	if a.CreditsPosted != 0 {
+		return tbtypes.AccountCreditsPostedMustBeZero
+	}
+	if e, ok := m.accounts[a.ID]; ok {
+		switch {
+		case a.Flags != e.Flags:
+			return tbtypes.AccountExistsWithDifferentFlags
+		case a.UserData != e.UserData:
+			return tbtypes.AccountExistsWithDifferentUserData
+		case a.Ledger != e.Ledger:
+			return tbtypes.AccountExistsWithDifferentLedger
+		case a.Code != e.Code:
+			return tbtypes.AccountExistsWithDifferentCode
+		}
+		return tbtypes.AccountExists
+	}
+
+	a.Timestamp = m.nextTimestamp()
+	m.saveAccount(a.ID)
+	m.accounts[a.ID] = a
+	return tbtypes.AccountOK
+}
+
+func (m *Memory) createTransfer(t tbtypes.Transfer) tbtypes.CreateTransferResult {
+	flags := DecodeTransferFlags(t.Flags)
+	if t.Timestamp != 0 {
+		return tbtypes.TransferTimestampMustBeZero
+	}
+	if t.Flags&^transferFlagsMask != 0 {
+		return tbtypes.TransferReservedFlag
+	}
+	if t.Reserved != zeroId {
+		return tbtypes.TransferReservedField
+	}
+	if t.ID == zeroId {
+		return tbtypes.TransferIDMustNotBeZero
+	}
+	if t.ID == maxId {
+		return tbtypes.TransferIDMustNotBeIntMax
+	}
+	if flags.PostPendingTransfer || flags.VoidPendingTransfer {
+		return m.postOrVoidPendingTransfer(t, flags)
+	}
+
+	if t.DebitAccountID == zeroId {
+		return tbtypes.TransferDebitAccountIDMustNotBeZero
+	}
+	if t.DebitAccountID == maxId {
+		return tbtypes.TransferDebitAccountIDMustNotBeIntMax
+	}
+	if t.CreditAccountID == zeroId {
+		return tbtypes.TransferCreditAccountIDMustNotBeZero
+	}
+	if t.CreditAccountID == maxId {
+		return tbtypes.TransferCreditAccountIDMustNotBeIntMax
+	}
+	if t.DebitAccountID == t.CreditAccountID {
+		return tbtypes.TransferAccountsMustBeDifferent
+	}
+	if t.PendingID != zeroId {
+		return tbtypes.TransferPendingIDMustBeZero
+	}
+	if !flags.Pending && t.Timeout != 0 {
+		return tbtypes.TransferTimeoutReservedForPendingTransfer
+	}
+	if t.Ledger == 0 {
+		return tbtypes.TransferLedgerMustNotBeZero
+	}
+	if t.Code == 0 {
+		return tbtypes.TransferCodeMustNotBeZero
+	}
+	if t.Amount == 0 {
+		return tbtypes.TransferAmountMustNotBeZero
+	}
+
+	dr, ok := m.accounts[t.DebitAccountID]
+	if !ok {
+		return tbtypes.TransferDebitAccountNotFound
+	}
+	cr, ok := m.accounts[t.CreditAccountID]
+	if !ok {
+		return tbtypes.TransferCreditAccountNotFound
+	}
+	if dr.Ledger != cr.Ledger {
+		return tbtypes.TransferAccountsMustHaveTheSameLedger
+	}
+	if t.Ledger != dr.Ledger {
+		return tbtypes.TransferTransferMustHaveTheSameLedgerAsAccounts
+	}
+
+	if e, ok := m.transfers[t.ID]; ok {
+		switch {
+		case t.Flags != e.Flags:
+			return tbtypes.TransferExistsWithDifferentFlags
+		case t.DebitAccountID != e.DebitAccountID:
+			return tbtypes.TransferExistsWithDifferentDebitAccountID
+		case t.CreditAccountID != e.CreditAccountID:
+			return tbtypes.TransferExistsWithDifferentCreditAccountID
+		case t.UserData != e.UserData:
+			return tbtypes.TransferExistsWithDifferentUserData
+		case t.PendingID != e.PendingID:
+			return tbtypes.TransferExistsWithDifferentPendingID
+		case t.Timeout != e.Timeout:
+			return tbtypes.TransferExistsWithDifferentTimeout
+		case t.Code != e.Code:
+			return tbtypes.TransferExistsWithDifferentCode
+		case t.Amount != e.Amount:
+			return tbtypes.TransferExistsWithDifferentAmount
+		}
+		return tbtypes.TransferExists
+	}
+
+	if flags.Pending {
+		if sumOverflows(t.Amount, dr.DebitsPending) {
+			return tbtypes.TransferOverflowsDebitsPending
+		}
+		if sumOverflows(t.Amount, cr.CreditsPending) {
+			return tbtypes.TransferOverflowsCreditsPending
+		}
+	}
+	if sumOverflows(t.Amount, dr.DebitsPosted) {
+		return tbtypes.TransferOverflowsDebitsPosted
+	}
+	if sumOverflows(t.Amount, cr.CreditsPosted) {
+		return tbtypes.TransferOverflowsCreditsPosted
+	}
+	if sumOverflows(t.Amount, dr.DebitsPending) || sumOverflows(t.Amount+dr.DebitsPending, dr.DebitsPosted) {
+		return tbtypes.TransferOverflowsDebits
+	}
+	if sumOverflows(t.Amount, cr.CreditsPending) || sumOverflows(t.Amount+cr.CreditsPending, cr.CreditsPosted) {
+		return tbtypes.TransferOverflowsCredits
+	}
+	timestamp := m.nextTimestamp()
+	if sumOverflows(timestamp, t.Timeout) {
+		return tbtypes.TransferOverflowsTimeout
+	}
+	drFlags := tbtypes.AccountFlags{DebitsMustNotExceedCredits: true}.ToUint16()
+	if dr.Flags&drFlags != 0 && dr.DebitsPending+dr.DebitsPosted+t.Amount > dr.CreditsPosted {
+		return tbtypes.TransferExceedsCredits
+	}
+	crFlags := tbtypes.AccountFlags{CreditsMustNotExceedDebits: true}.ToUint16()
+	if cr.Flags&crFlags != 0 && cr.CreditsPending+cr.CreditsPosted+t.Amount > cr.DebitsPosted {
+		return tbtypes.TransferExceedsDebits
+	}
+
+	m.saveAccount(dr.ID)
+	m.saveAccount(cr.ID)
+	if flags.Pending {
+		dr.DebitsPending += t.Amount
+		cr.CreditsPending += t.Amount
+		m.setPending(t.ID, pendingOpen)
+	} else {
+		dr.DebitsPosted += t.Amount
+		cr.CreditsPosted += t.Amount
+	}
+	m.accounts[dr.ID] = dr
+	m.accounts[cr.ID] = cr
+
+	t.Timestamp = timestamp
+	m.saveTransfer(t)
+	return tbtypes.TransferOK
+}
+
+func (m *Memory) postOrVoidPendingTransfer(t tbtypes.Transfer, flags tbtypes.TransferFlags) tbtypes.CreateTransferResult {
+	if flags.PostPendingTransfer && flags.VoidPendingTransfer {
+		return tbtypes.TransferCannotPostAndVoidPendingTransfer
+	}
+	if flags.Pending {
+		return tbtypes.TransferPendingTransferCannotPostOrVoidAnother
+	}
+	if t.Timeout != 0 {
+		return tbtypes.TransferTimeoutReservedForPendingTransfer
+	}
+	if t.PendingID == zeroId {
+		return tbtypes.TransferPendingIDMustNotBeZero
+	}
+	if t.PendingID == maxId {
+		return tbtypes.TransferPendingIDMustNotBeIntMax
+	}
+	if t.PendingID == t.ID {
+		return tbtypes.TransferPendingIDMustBeDifferent
+	}
+
+	p, ok := m.transfers[t.PendingID]
+	if !ok {
+		return tbtypes.TransferPendingTransferNotFound
+	}
+	if !DecodeTransferFlags(p.Flags).Pending {
+		return tbtypes.TransferPendingTransferNotPending
+	}
+	if t.DebitAccountID != zeroId && t.DebitAccountID != p.DebitAccountID {
+		return tbtypes.TransferPendingTransferHasDifferentDebitAccountID
+	}
+	if t.CreditAccountID != zeroId && t.CreditAccountID != p.CreditAccountID {
+		return tbtypes.TransferPendingTransferHasDifferentCreditAccountID
+	}
+	if t.Ledger != 0 && t.Ledger != p.Ledger {
+		return tbtypes.TransferPendingTransferHasDifferentLedger
+	}
+	if t.Code != 0 && t.Code != p.Code {
+		return tbtypes.TransferPendingTransferHasDifferentCode
+	}
+	amount := p.Amount
+	if t.Amount > 0 {
+		amount = t.Amount
+	}
+	if amount > p.Amount {
+		return tbtypes.TransferExceedsPendingTransferAmount
+	}
+	if flags.VoidPendingTransfer && amount < p.Amount {
+		return tbtypes.TransferPendingTransferHasDifferentAmount
+	}
+
+	if e, ok := m.transfers[t.ID]; ok {
+		switch {
+		case t.Flags != e.Flags:
+			return tbtypes.TransferExistsWithDifferentFlags
+		case t.PendingID != e.PendingID:
+			return tbtypes.TransferExistsWithDifferentPendingID
+		case t.UserData != e.UserData:
+			return tbtypes.TransferExistsWithDifferentUserData
+		case amount != e.Amount:
+			return tbtypes.TransferExistsWithDifferentAmount
+		}
+		return tbtypes.TransferExists
+	}
+
+	switch m.pending[p.ID] {
+	case pendingPosted:
+		return tbtypes.TransferPendingTransferAlreadyPosted
+	case pendingVoided:
+		return tbtypes.TransferPendingTransferAlreadyVoided
+	}
+	timestamp := m.nextTimestamp()
+	if p.Timeout != 0 && p.Timestamp+p.Timeout <= timestamp {
+		return tbtypes.TransferPendingTransferExpired
+	}
+
+	dr := m.accounts[p.DebitAccountID]
+	cr := m.accounts[p.CreditAccountID]
+	m.saveAccount(dr.ID)
+	m.saveAccount(cr.ID)
+	dr.DebitsPending -= p.Amount
+	cr.CreditsPending -= p.Amount
+	if flags.PostPendingTransfer {
+		dr.DebitsPosted += amount
+		cr.CreditsPosted += amount
+		m.setPending(p.ID, pendingPosted)
+	} else {
+		m.setPending(p.ID, pendingVoided)
+	}
+	m.accounts[dr.ID] = dr
+	m.accounts[cr.ID] = cr
+
+	t.DebitAccountID = p.DebitAccountID
+	t.CreditAccountID = p.CreditAccountID
+	t.Ledger = p.Ledger
+	t.Code = p.Code
+	t.Amount = amount
+	t.Timestamp = timestamp
+	m.saveTransfer(t)
+	return tbtypes.TransferOK
+}
+
+func (m *Memory) saveAccount(id tbtypes.Uint128) {
+	if m.undo == nil {
+		return
+	}
+	if _, ok := m.undo.accounts[id]; ok {
+		return
+	}
+	if a, ok := m.accounts[id]; ok {
+		m.undo.accounts[id] = &a
+	} else {
+		m.undo.accounts[id] = nil
+	}
+}
+
+func (m *Memory) saveTransfer(t tbtypes.Transfer) {
+	if m.undo != nil {
+		m.undo.transfers = append(m.undo.transfers, t.ID)
+	}
+	m.transfers[t.ID] = t
+}
+
+func (m *Memory) setPending(id tbtypes.Uint128, state pendingState) {
+	if m.undo != nil {
+		if _, ok := m.undo.pending[id]; !ok {
+			if previous, ok := m.pending[id]; ok {
+				m.undo.pending[id] = &previous
+			} else {
+				m.undo.pending[id] = nil
+			}
+		}
+	}
+	m.pending[id] = state
+}
+
+func (m *Memory) rollback() {
+	for id, a := range m.undo.accounts {
+		if a == nil {
+			delete(m.accounts, id)
+		} else {
+			m.accounts[id] = *a
+		}
+	}
+	for _, id := range m.undo.transfers {
+		delete(m.transfers, id)
+	}
+	for id, state := range m.undo.pending {
+		if state == nil {
+			delete(m.pending, id)
+		} else {
+			m.pending[id] = *state
+		}
+	}
+	m.undo = newUndoLog()
+}
+
+func newUndoLog() *undoLog {
+	return &undoLog{
+		accounts: map[tbtypes.Uint128]*tbtypes.Account{},
+		pending:  map[tbtypes.Uint128]*pendingState{},
+	}
+}
+
+func sumOverflows(a, b uint64) bool {
+	return a > math.MaxUint64-b
+}
@@ -0,0 +1,326 @@
+package ledger
+
+import (
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"testing"
+)
+
+const testLedger = 1
+
+func testId(n uint64) tbtypes.Uint128 {
+	var bytes [16]byte
+	for i := 0; i < 8; i++ {
+		bytes[i] = byte(n >> (8 * i))
+	}
+	return tbtypes.BytesToUint128(bytes)
+}
+
+// newTestMemory is a memory ledger with a funding account 1, which can be
+// overdrawn, and customer accounts 2 and 3, which can't.
+func newTestMemory(t *testing.T) *Memory {
+	m := NewMemory()
+	noOverdraft := tbtypes.AccountFlags{DebitsMustNotExceedCredits: true}.ToUint16()
+	res, err := m.CreateAccounts([]tbtypes.Account{
+		{ID: testId(1), Ledger: testLedger, Code: 1},
+		{ID: testId(2), Ledger: testLedger, Code: 1, Flags: noOverdraft},
+		{ID: testId(3), Ledger: testLedger, Code: 1, Flags: noOverdraft},
+	})
+	if err != nil || len(res) != 0 {
+		t.Fatalf("creating accounts: %v, %v", res, err)
+	}
+	return m
+}
+
+func testTransfer(id uint64, debit uint64, credit uint64, amount uint64) tbtypes.Transfer {
+	return tbtypes.Transfer{
+		ID:              testId(id),
+		DebitAccountID:  testId(debit),
+		CreditAccountID: testId(credit),
+		Amount:          amount,
+		Ledger:          testLedger,
+		Code:            1,
+	}
+}
+
+func withFlags(t tbtypes.Transfer, flags tbtypes.TransferFlags) tbtypes.Transfer {
+	t.Flags = flags.ToUint16()
+	return t
+}
+
+func lookupAccount(t *testing.T, m *Memory, id uint64) tbtypes.Account {
+	accounts, err := m.LookupAccounts([]tbtypes.Uint128{testId(id)})
+	if err != nil || len(accounts) != 1 {
+		t.Fatalf("looking up account %d: %v, %v", id, accounts, err)
+	}
+	return accounts[0]
+}
+
+func createTransfers(t *testing.T, m *Memory, transfers ...tbtypes.Transfer) []tbtypes.TransferEventResult {
+	res, err := m.CreateTransfers(transfers)
+	if err != nil {
+		t.Fatalf("creating transfers: %v", err)
+	}
+	return res
+}
+
+func TestMemoryCreateAccountResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		account tbtypes.Account
+		want    tbtypes.CreateAccountResult
+	}{
+		{"ok", tbtypes.Account{ID: testId(10), Ledger: testLedger, Code: 1}, tbtypes.AccountOK},
+		{"zero id", tbtypes.Account{Ledger: testLedger, Code: 1}, tbtypes.AccountIDMustNotBeZero},
+		{"max id", tbtypes.Account{ID: maxId, Ledger: testLedger, Code: 1}, tbtypes.AccountIDMustNotBeIntMax},
+		{"no ledger", tbtypes.Account{ID: testId(10), Code: 1}, tbtypes.AccountLedgerMustNotBeZero},
+		{"no code", tbtypes.Account{ID: testId(10), Ledger: testLedger}, tbtypes.AccountCodeMustNotBeZero},
+		{"timestamp", tbtypes.Account{ID: testId(10), Ledger: testLedger, Code: 1, Timestamp: 1}, tbtypes.AccountTimestampMustBeZero},
+		{"reserved flag", tbtypes.Account{ID: testId(10), Ledger: testLedger, Code: 1, Flags: 1 << 3}, tbtypes.AccountReservedFlag},
+		{
+			"exclusive flags",
+			tbtypes.Account{ID: testId(10), Ledger: testLedger, Code: 1, Flags: tbtypes.AccountFlags{DebitsMustNotExceedCredits: true, CreditsMustNotExceedDebits: true}.ToUint16()},
+			tbtypes.AccountMutuallyExclusiveFlags,
+		},
+		{"balance", tbtypes.Account{ID: testId(10), Ledger: testLedger, Code: 1, CreditsPosted: 1}, tbtypes.AccountCreditsPostedMustBeZero},
+		{"exists", tbtypes.Account{ID: testId(1), Ledger: testLedger, Code: 1}, tbtypes.AccountExists},
+		{"exists with different ledger", tbtypes.Account{ID: testId(1), Ledger: 2, Code: 1}, tbtypes.AccountExistsWithDifferentLedger},
+		{
+			"exists with different flags",
+			tbtypes.Account{ID: testId(1), Ledger: testLedger, Code: 1, Flags: tbtypes.AccountFlags{DebitsMustNotExceedCredits: true}.ToUint16()},
+			tbtypes.AccountExistsWithDifferentFlags,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestMemory(t)
+			res, err := m.CreateAccounts([]tbtypes.Account{test.account})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := tbtypes.AccountOK
+			if len(res) > 0 {
+				got = res[0].Result
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCreateTransferResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		transfer tbtypes.Transfer
+		want     tbtypes.CreateTransferResult
+	}{
+		{"ok", testTransfer(10, 1, 2, 100), tbtypes.TransferOK},
+		{"zero id", testTransfer(0, 1, 2, 100), tbtypes.TransferIDMustNotBeZero},
+		{"zero amount", testTransfer(10, 1, 2, 0), tbtypes.TransferAmountMustNotBeZero},
+		{"same accounts", testTransfer(10, 1, 1, 100), tbtypes.TransferAccountsMustBeDifferent},
+		{"debit account not found", testTransfer(10, 9, 2, 100), tbtypes.TransferDebitAccountNotFound},
+		{"credit account not found", testTransfer(10, 1, 9, 100), tbtypes.TransferCreditAccountNotFound},
+		{"exceeds credits", testTransfer(10, 2, 3, 501), tbtypes.TransferExceedsCredits},
+		{"timeout without pending", func() tbtypes.Transfer {
+			transfer := testTransfer(10, 1, 2, 100)
+			transfer.Timeout = 1
+			return transfer
+		}(), tbtypes.TransferTimeoutReservedForPendingTransfer},
+		{"different ledger", func() tbtypes.Transfer {
+			transfer := testTransfer(10, 1, 2, 100)
+			transfer.Ledger = 2
+			return transfer
+		}(), tbtypes.TransferTransferMustHaveTheSameLedgerAsAccounts},
+		{"exists", testTransfer(5, 1, 2, 500), tbtypes.TransferExists},
+		{"exists with different amount", testTransfer(5, 1, 2, 400), tbtypes.TransferExistsWithDifferentAmount},
+		{"exists with different credit account", testTransfer(5, 1, 3, 500), tbtypes.TransferExistsWithDifferentCreditAccountID},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestMemory(t)
+			if res := createTransfers(t, m, testTransfer(5, 1, 2, 500)); len(res) != 0 {
+				t.Fatalf("funding account: %v", res)
+			}
+			got := tbtypes.TransferOK
+			if res := createTransfers(t, m, test.transfer); len(res) > 0 {
+				got = res[0].Result
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMemoryBatchErrors(t *testing.T) {
+	m := newTestMemory(t)
+	if _, err := m.CreateTransfers(nil); err == nil {
+		t.Error("empty batch: got no error")
+	}
+	if _, err := m.CreateTransfers(make([]tbtypes.Transfer, MaxBatchSize+1)); err == nil {
+		t.Error("oversized batch: got no error")
+	}
+	m.Close()
+	if _, err := m.LookupAccounts([]tbtypes.Uint128{testId(1)}); err == nil {
+		t.Error("closed ledger: got no error")
+	}
+}
+
+func TestMemoryLinkedChainRollback(t *testing.T) {
+	linked := tbtypes.TransferFlags{Linked: true}
+	tests := []struct {
+		name      string
+		transfers []tbtypes.Transfer
+		want      []tbtypes.TransferEventResult
+		// balance2 is the posted credits of account 2 afterwards.
+		balance2 uint64
+	}{
+		{
+			name: "chain succeeds",
+			transfers: []tbtypes.Transfer{
+				withFlags(testTransfer(10, 1, 2, 100), linked),
+				testTransfer(11, 1, 2, 50),
+			},
+			balance2: 150,
+		},
+		{
+			name: "last event fails",
+			transfers: []tbtypes.Transfer{
+				withFlags(testTransfer(10, 1, 2, 100), linked),
+				testTransfer(11, 2, 3, 1000),
+			},
+			want: []tbtypes.TransferEventResult{
+				{Index: 0, Result: tbtypes.TransferLinkedEventFailed},
+				{Index: 1, Result: tbtypes.TransferExceedsCredits},
+			},
+		},
+		{
+			name: "events after the failure fail",
+			transfers: []tbtypes.Transfer{
+				withFlags(testTransfer(10, 1, 2, 100), linked),
+				withFlags(testTransfer(11, 9, 2, 100), linked),
+				testTransfer(12, 1, 2, 100),
+				testTransfer(13, 1, 2, 25),
+			},
+			want: []tbtypes.TransferEventResult{
+				{Index: 0, Result: tbtypes.TransferLinkedEventFailed},
+				{Index: 1, Result: tbtypes.TransferDebitAccountNotFound},
+				{Index: 2, Result: tbtypes.TransferLinkedEventFailed},
+			},
+			balance2: 25,
+		},
+		{
+			name: "open chain",
+			transfers: []tbtypes.Transfer{
+				testTransfer(10, 1, 2, 100),
+				withFlags(testTransfer(11, 1, 2, 100), linked),
+			},
+			want: []tbtypes.TransferEventResult{
+				{Index: 1, Result: tbtypes.TransferLinkedEventChainOpen},
+			},
+			balance2: 100,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestMemory(t)
+			res := createTransfers(t, m, test.transfers...)
+			if len(res) != len(test.want) {
+				t.Fatalf("got results %v, want %v", res, test.want)
+			}
+			for i := range res {
+				if res[i] != test.want[i] {
+					t.Errorf("result %d: got %v, want %v", i, res[i], test.want[i])
+				}
+			}
+			if got := lookupAccount(t, m, 2).CreditsPosted; got != test.balance2 {
+				t.Errorf("credits posted: got %d, want %d", got, test.balance2)
+			}
+			// Transfers of a failed chain are rolled back.
+			failed := map[uint32]bool{}
+			for _, result := range res {
+				failed[result.Index] = true
+			}
+			for i, transfer := range test.transfers {
+				transfers, err := m.LookupTransfers([]tbtypes.Uint128{transfer.ID})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if exists := len(transfers) != 0; exists == failed[uint32(i)] {
+					t.Errorf("transfer %d: exists is %v, failed is %v", i, exists, failed[uint32(i)])
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryPendingTransfers(t *testing.T) {
+	pending := tbtypes.TransferFlags{Pending: true}
+	post := tbtypes.TransferFlags{PostPendingTransfer: true}
+	void := tbtypes.TransferFlags{VoidPendingTransfer: true}
+	resolve := func(id uint64, flags tbtypes.TransferFlags, amount uint64) tbtypes.Transfer {
+		return withFlags(tbtypes.Transfer{ID: testId(id), PendingID: testId(20), Amount: amount}, flags)
+	}
+	tests := []struct {
+		name string
+		// timeout is the timeout of the pending transfer.
+		timeout   uint64
+		resolve   []tbtypes.Transfer
+		want      tbtypes.CreateTransferResult
+		debits    uint64
+		pending   uint64
+		available uint64
+	}{
+		{"pending", 0, nil, tbtypes.TransferOK, 0, 300, 700},
+		{"post all", 0, []tbtypes.Transfer{resolve(21, post, 0)}, tbtypes.TransferOK, 300, 0, 700},
+		{"post part", 0, []tbtypes.Transfer{resolve(21, post, 200)}, tbtypes.TransferOK, 200, 0, 800},
+		{"post more", 0, []tbtypes.Transfer{resolve(21, post, 301)}, tbtypes.TransferExceedsPendingTransferAmount, 0, 300, 700},
+		{"void", 0, []tbtypes.Transfer{resolve(21, void, 0)}, tbtypes.TransferOK, 0, 0, 1000},
+		{"void part", 0, []tbtypes.Transfer{resolve(21, void, 200)}, tbtypes.TransferPendingTransferHasDifferentAmount, 0, 300, 700},
+		{"post twice", 0, []tbtypes.Transfer{resolve(21, post, 0), resolve(22, post, 0)}, tbtypes.TransferPendingTransferAlreadyPosted, 300, 0, 700},
+		{"void posted", 0, []tbtypes.Transfer{resolve(21, post, 0), resolve(22, void, 0)}, tbtypes.TransferPendingTransferAlreadyPosted, 300, 0, 700},
+		{"post voided", 0, []tbtypes.Transfer{resolve(21, void, 0), resolve(22, post, 0)}, tbtypes.TransferPendingTransferAlreadyVoided, 0, 0, 1000},
+		// The ledger does not release the amount of an expired transfer.
+		{"post expired", 1, []tbtypes.Transfer{resolve(21, post, 0)}, tbtypes.TransferPendingTransferExpired, 0, 300, 700},
+		{"void expired", 1, []tbtypes.Transfer{resolve(21, void, 0)}, tbtypes.TransferPendingTransferExpired, 0, 300, 700},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestMemory(t)
+			hold := withFlags(testTransfer(20, 2, 1, 300), pending)
+			hold.Timeout = test.timeout
+			if res := createTransfers(t, m, testTransfer(10, 1, 2, 1000), hold); len(res) != 0 {
+				t.Fatalf("creating pending transfer: %v", res)
+			}
+			got := tbtypes.TransferOK
+			for _, transfer := range test.resolve {
+				if res := createTransfers(t, m, transfer); len(res) > 0 {
+					got = res[0].Result
+				}
+			}
+			if got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			account := lookupAccount(t, m, 2)
+			if account.DebitsPosted != test.debits || account.DebitsPending != test.pending {
+				t.Errorf("got debits %d posted, %d pending, want %d, %d", account.DebitsPosted, account.DebitsPending, test.debits, test.pending)
+			}
+			if available := NewBalance(account).Available.Uint64(); available != test.available {
+				t.Errorf("available: got %d, want %d", available, test.available)
+			}
+		})
+	}
+}
+
+func TestMemoryPendingTransferExceedsCredits(t *testing.T) {
+	m := newTestMemory(t)
+	pending := tbtypes.TransferFlags{Pending: true}
+	res := createTransfers(t, m,
+		testTransfer(10, 1, 2, 100),
+		withFlags(testTransfer(11, 2, 1, 60), pending),
+		withFlags(testTransfer(12, 2, 1, 60), pending),
+	)
+	if len(res) != 1 || res[0].Index != 2 || res[0].Result != tbtypes.TransferExceedsCredits {
+		t.Errorf("got %v, want the second hold to exceed credits", res)
+	}
+}
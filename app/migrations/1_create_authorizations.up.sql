@@ -0,0 +1,8 @@
+CREATE TABLE authorizations (
+    transfer_id      TEXT PRIMARY KEY,
+    debit_account_id TEXT NOT NULL,
+    amount           BIGINT NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX authorizations_account_amount_idx ON authorizations (debit_account_id, amount, created_at);
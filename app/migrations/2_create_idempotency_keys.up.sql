@@ -0,0 +1,6 @@
+CREATE TABLE idempotency_keys (
+    key        TEXT PRIMARY KEY,
+    request    TEXT NOT NULL,
+    response   BYTEA,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,15 @@
+CREATE TABLE accounts (
+    account_id                     TEXT PRIMARY KEY,
+    type                           TEXT NOT NULL,
+    ledger                         BIGINT NOT NULL,
+    code                           INTEGER NOT NULL,
+    debits_must_not_exceed_credits BOOLEAN NOT NULL,
+    credits_must_not_exceed_debits BOOLEAN NOT NULL,
+    external_references            JSONB NOT NULL DEFAULT '{}',
+    name                           TEXT NOT NULL DEFAULT '',
+    owner                          TEXT NOT NULL DEFAULT '',
+    tags                           JSONB NOT NULL DEFAULT '[]',
+    created_at                     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX accounts_owner_idx ON accounts (owner);
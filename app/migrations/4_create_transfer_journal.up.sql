@@ -0,0 +1,15 @@
+CREATE TABLE transfer_journal (
+    transfer_id       TEXT PRIMARY KEY,
+    debit_account_id  TEXT NOT NULL,
+    credit_account_id TEXT NOT NULL,
+    amount            BIGINT NOT NULL,
+    pending_id        TEXT,
+    user_data         TEXT NOT NULL,
+    timeout           BIGINT NOT NULL,
+    ledger            BIGINT NOT NULL,
+    code              INTEGER NOT NULL,
+    flags             INTEGER NOT NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX transfer_journal_pending_idx ON transfer_journal (pending_id) WHERE pending_id IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE transfer_journal ADD COLUMN timestamp BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX transfer_journal_debit_idx ON transfer_journal (debit_account_id, timestamp);
+CREATE INDEX transfer_journal_credit_idx ON transfer_journal (credit_account_id, timestamp);
@@ -0,0 +1,11 @@
+CREATE TABLE fx_transfers (
+    debit_transfer_id   TEXT PRIMARY KEY,
+    credit_transfer_id  TEXT NOT NULL UNIQUE,
+    debit_currency      TEXT NOT NULL,
+    credit_currency     TEXT NOT NULL,
+    debit_amount        BIGINT NOT NULL,
+    credit_amount       BIGINT NOT NULL,
+    rate                TEXT NOT NULL,
+    spread_basis_points BIGINT NOT NULL,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -3,35 +3,109 @@ package app
 import (
 	"context"
 	"encore.app/app/workflow"
+	"encore.dev/beta/errs"
 	"encore.dev/rlog"
-	"github.com/google/uuid"
 	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
-	"go.temporal.io/sdk/client"
 )
 
+type PresentParams struct {
+	IdempotencyKey string `header:"Idempotency-Key"`
+	// AuthorizationId, as returned by Authorize, selects the authorization to
+	// capture. Without it the smallest authorization on the account covering
+	// the amount, and not made by another merchant, is captured if it is
+	// within PresentmentTolerancePercent of the amount.
+	AuthorizationId string
+	MerchantId      string
+	// FinalCapture releases whatever remains of the authorization after this
+	// capture. Set it to false for split shipments to keep the remainder held
+	// for later presentments. Defaults to true.
+	FinalCapture *bool
+	Currency     string
+}
+
 type PresentResponse struct {
 	PresentmentMatched bool
+	AuthorizationId    string
+	// CapturedAmount is the presented amount, posted against the matched
+	// authorization. ReleasedAmount is what was left of the hold on a final
+	// capture, RemainingAmount what is still held for later captures.
+	CapturedAmount  uint64
+	ReleasedAmount  uint64
+	RemainingAmount uint64
+	Currency        string
 }
 
 //encore:api public method=POST path=/present/:accountId/:amount
-func (s *Service) Present(ctx context.Context, accountId string, amount uint64) (*PresentResponse, error) {
-	accountIdCasted, _ := tbtypes.HexStringToUint128(accountId)
-	options := client.StartWorkflowOptions{
-		ID:        uuid.New().String(),
-		TaskQueue: taskQueue,
+func (s *Service) Present(ctx context.Context, accountId string, amount uint64, params *PresentParams) (*PresentResponse, error) {
+	request := []interface{}{"present", accountId, amount, params}
+	return idempotent(ctx, s.idempotencyKeys, params.IdempotencyKey, request, func(requestKey string) (*PresentResponse, error) {
+		return s.present(ctx, accountId, amount, params, requestKey)
+	})
+}
+
+func (s *Service) present(ctx context.Context, accountId string, amount uint64, params *PresentParams, requestKey string) (*PresentResponse, error) {
+	if amount == 0 {
+		return nil, &errs.Error{Code: errs.InvalidArgument, Message: "amount must not be zero"}
+	}
+	err := checkAmount("amount", amount)
+	if err != nil {
+		return nil, err
+	}
+	accountIdCasted, err := parseId("accountId", accountId)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := s.ledger.LookupAccounts([]tbtypes.Uint128{accountIdCasted})
+	if err != nil {
+		rlog.Error("failed to fetch accounts", "error", err)
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		rlog.Info("account not found", "accountId", accountId)
+		return &PresentResponse{PresentmentMatched: false}, nil
+	}
+	currency, err := s.accountCurrency("Currency", params.Currency, accounts[0].Ledger)
+	if err != nil {
+		return nil, err
 	}
-	we, err := s.temporalClient.ExecuteWorkflow(ctx, options, workflow.Present, accountIdCasted, amount)
 
+	authorizationIdCasted := workflow.InvalidTransferId
+	if params.AuthorizationId != "" {
+		authorizationIdCasted, err = parseId("AuthorizationId", params.AuthorizationId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	operation := workflow.AccountOperation{
+		Type:            workflow.OperationPresent,
+		RequestId:       requestId(workflow.OperationPresent, requestKey),
+		Amount:          amount,
+		Final:           params.FinalCapture == nil || *params.FinalCapture,
+		MerchantId:      params.MerchantId,
+		MaxAmount:       workflow.PresentmentMaxAmount(amount, cfg.PresentmentTolerancePercent),
+		AuthorizationId: authorizationIdCasted,
+	}
+	err = s.signalAccount(ctx, accountIdCasted, operation)
 	if err != nil {
-		rlog.Error("failed to start workflow", "error", err)
+		rlog.Error("failed to signal account workflow", "error", err)
 		return &PresentResponse{PresentmentMatched: false}, err
 	}
-	rlog.Info("started workflow", "id", we.GetID(), "run_id", we.GetRunID())
+	rlog.Info("queued presentment", "id", operation.RequestId)
 
-	var presentmentMatched bool
-	err = we.Get(ctx, &presentmentMatched)
+	var result workflow.PresentResult
+	err = s.awaitOperation(ctx, operation.RequestId, &result)
 	if err != nil {
 		return &PresentResponse{PresentmentMatched: false}, err
 	}
-	return &PresentResponse{PresentmentMatched: presentmentMatched}, nil
+	if !result.Matched {
+		return &PresentResponse{PresentmentMatched: false}, nil
+	}
+	return &PresentResponse{
+		PresentmentMatched: true,
+		AuthorizationId:    result.AuthorizationId.String(),
+		CapturedAmount:     result.CapturedAmount,
+		ReleasedAmount:     result.ReleasedAmount,
+		RemainingAmount:    result.RemainingAmount,
+		Currency:           currency.Code,
+	}, nil
 }
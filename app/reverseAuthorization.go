@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"encore.app/app/workflow"
+	"encore.dev/rlog"
+)
+
+type ReverseAuthorizationParams struct {
+	IdempotencyKey string `header:"Idempotency-Key"`
+	// Amount to release from the hold. Zero, or anything covering the amount
+	// still held, reverses the whole authorization.
+	Amount   uint64
+	Currency string
+}
+
+type ReverseAuthorizationResponse struct {
+	Reversed        bool
+	AuthorizationId string
+	ReversedAmount  uint64
+	RemainingAmount uint64
+	Currency        string
+}
+
+//encore:api public method=POST path=/authorization/:authorizationId/reverse
+func (s *Service) ReverseAuthorization(ctx context.Context, authorizationId string, params *ReverseAuthorizationParams) (*ReverseAuthorizationResponse, error) {
+	request := []interface{}{"reverse", authorizationId, params}
+	return idempotent(ctx, s.idempotencyKeys, params.IdempotencyKey, request, func(requestKey string) (*ReverseAuthorizationResponse, error) {
+		return s.reverseAuthorization(ctx, authorizationId, params, requestKey)
+	})
+}
+
+func (s *Service) reverseAuthorization(ctx context.Context, authorizationId string, params *ReverseAuthorizationParams, requestKey string) (*ReverseAuthorizationResponse, error) {
+	err := checkAmount("Amount", params.Amount)
+	if err != nil {
+		return nil, err
+	}
+	authorizationIdCasted, err := parseId("authorizationId", authorizationId)
+	if err != nil {
+		return nil, err
+	}
+	authorization, found, err := s.lookupAuthorization(authorizationIdCasted)
+	if err != nil {
+		rlog.Error("failed to get authorization", "error", err)
+		return nil, err
+	}
+	if !found {
+		rlog.Info("authorization not found", "authorizationId", authorizationId)
+		return &ReverseAuthorizationResponse{Reversed: false, AuthorizationId: authorizationIdCasted.String()}, nil
+	}
+
+	currency, err := s.accountCurrency("Currency", params.Currency, authorization.Ledger)
+	if err != nil {
+		return nil, err
+	}
+	operation := workflow.AccountOperation{
+		Type:            workflow.OperationVoid,
+		RequestId:       requestId(workflow.OperationVoid, requestKey),
+		Amount:          params.Amount,
+		AuthorizationId: authorizationIdCasted,
+	}
+	err = s.signalAccount(ctx, authorization.DebitAccountID, operation)
+	if err != nil {
+		rlog.Error("failed to signal account workflow", "error", err)
+		return nil, err
+	}
+	rlog.Info("queued authorization reversal", "id", operation.RequestId)
+
+	var result workflow.ReverseResult
+	err = s.awaitOperation(ctx, operation.RequestId, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &ReverseAuthorizationResponse{
+		Reversed:        result.Reversed,
+		AuthorizationId: authorizationIdCasted.String(),
+		ReversedAmount:  result.ReversedAmount,
+		RemainingAmount: result.RemainingAmount,
+		Currency:        currency.Code,
+	}, nil
+}
@@ -0,0 +1,143 @@
+package app
+
+import (
+	"context"
+	"encore.app/app/ledger"
+	"encore.app/app/workflow"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"fmt"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"strings"
+)
+
+// systemOwner owns the system accounts of the currencies.
+const systemOwner = "system"
+
+type merchantCurrency struct {
+	MerchantId string
+	Currency   string
+}
+
+// newMerchantAccounts are the settlement accounts of the configured merchants.
+func newMerchantAccounts(currencies *ledger.Currencies) (map[merchantCurrency]tbtypes.Uint128, error) {
+	accounts := map[merchantCurrency]tbtypes.Uint128{}
+	for _, merchant := range cfg.Merchants {
+		currency, ok := currencies.Lookup(merchant.Currency)
+		if !ok {
+			return nil, fmt.Errorf("merchant %q settles in %q, which is not a supported currency", merchant.MerchantId, merchant.Currency)
+		}
+		key := merchantCurrency{MerchantId: merchant.MerchantId, Currency: currency.Code}
+		if _, ok := accounts[key]; ok {
+			return nil, fmt.Errorf("merchant %q has two settlement accounts in %s", merchant.MerchantId, currency.Code)
+		}
+		accountId, err := ledger.ParseId(merchant.SettlementAccountId)
+		if err != nil {
+			return nil, fmt.Errorf("settlement account of merchant %q: %v", merchant.MerchantId, err)
+		}
+		accounts[key] = accountId
+	}
+	return accounts, nil
+}
+
+// settlementAccount is the account credited by a merchant's authorizations in
+// a currency: the merchant's settlement account, or the currency's treasury
+// account.
+func (s *Service) settlementAccount(merchantId string, currency ledger.Currency) (tbtypes.Uint128, error) {
+	if accountId, ok := s.merchantAccounts[merchantCurrency{MerchantId: merchantId, Currency: currency.Code}]; ok {
+		return accountId, nil
+	}
+	if currency.TreasuryAccountId == workflow.InvalidTransferId {
+		return workflow.InvalidTransferId, &errs.Error{Code: errs.FailedPrecondition, Message: fmt.Sprintf("no account to settle authorizations in %s to", currency.Code)}
+	}
+	return currency.TreasuryAccountId, nil
+}
+
+// systemAccounts are the system accounts of the currencies and the settlement
+// accounts of the merchants, by ID.
+func (s *Service) systemAccounts() map[tbtypes.Uint128]AccountDetails {
+	unrestricted := false
+	accounts := map[tbtypes.Uint128]AccountDetails{}
+	for _, currency := range s.currencies.All() {
+		for _, account := range []struct {
+			id          tbtypes.Uint128
+			name        string
+			accountType string
+		}{
+			{currency.TreasuryAccountId, "treasury", AccountTypeAsset},
+			{currency.SuspenseAccountId, "suspense", AccountTypeLiability},
+			{currency.FeesAccountId, "fees", AccountTypeRevenue},
+			{currency.FxAccountId, "FX liquidity", AccountTypeAsset},
+		} {
+			if account.id == workflow.InvalidTransferId {
+				continue
+			}
+			// The service moves funds through system accounts on behalf of
+			// customers, their balances are not limited.
+			accounts[account.id] = AccountDetails{
+				Type:                       account.accountType,
+				Currency:                   currency.Code,
+				DebitsMustNotExceedCredits: &unrestricted,
+				Name:                       currency.Code + " " + account.name,
+				Owner:                      systemOwner,
+				Tags:                       []string{systemOwner},
+			}
+		}
+	}
+	for merchant, accountId := range s.merchantAccounts {
+		accounts[accountId] = AccountDetails{
+			Type:     AccountTypeLiability,
+			Currency: merchant.Currency,
+			Name:     merchant.MerchantId + " " + merchant.Currency + " settlement",
+			Owner:    merchant.MerchantId,
+		}
+	}
+	return accounts
+}
+
+// bootstrapSystemAccounts creates the system accounts that don't exist yet.
+// Accounts that exist are left as they are, even if they were created
+// differently.
+func (s *Service) bootstrapSystemAccounts(ctx context.Context) error {
+	var accounts []tbtypes.Account
+	var metadata []AccountMetadata
+	for accountId, details := range s.systemAccounts() {
+		account, accountMetadata, err := s.newAccount(accountId, details)
+		if err != nil {
+			return fmt.Errorf("account %s: %v", accountId, err)
+		}
+		accounts = append(accounts, account)
+		metadata = append(metadata, accountMetadata)
+	}
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	res, err := s.ledger.CreateAccounts(accounts)
+	if err != nil {
+		return err
+	}
+	existing := map[uint32]bool{}
+	for _, r := range res {
+		reason := ledger.AccountReason(r.Result)
+		if !strings.HasPrefix(reason, "exists") {
+			return fmt.Errorf("account %s: %v", accounts[r.Index].ID, ledger.AccountError(r.Result))
+		}
+		if r.Result != tbtypes.AccountExists {
+			rlog.Warn("system account exists with different settings", "accountId", accounts[r.Index].ID.String(), "result", reason)
+		}
+		existing[r.Index] = true
+	}
+	// Existing accounts keep their metadata, but get it if an earlier start
+	// did not store it.
+	for i, account := range accounts {
+		_, err = storeAccountMetadata(ctx, metadata[i])
+		if err != nil {
+			return fmt.Errorf("metadata of account %s: %v", account.ID, err)
+		}
+		if !existing[uint32(i)] {
+			rlog.Info("created system account", "accountId", account.ID.String(), "name", metadata[i].Name)
+		}
+	}
+	return nil
+}
@@ -2,68 +2,222 @@ package app
 
 import (
 	"context"
+	"encore.app/app/ledger"
+	"encore.app/app/workflow"
+	"encore.dev/beta/errs"
 	"encore.dev/rlog"
+	"fmt"
 	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
-	"strconv"
-	"time"
 )
 
+type TransferParams struct {
+	IdempotencyKey string `header:"Idempotency-Key"`
+	// Currency defaults to the debit account's.
+	Currency string
+}
+
 type TransferResponse struct {
+	TransferId      string
 	DebitAccountId  string
 	CreditAccountId string
 	Amount          uint64
+	Currency        string
 }
 
 //encore:api public method=POST path=/transfer/:debitAccountId/:creditAccountId/:amount
-func (s *Service) Transfer(ctx context.Context, debitAccountId string, creditAccountId string, amount uint64) (*TransferResponse, error) {
-	debitAccountIdCasted, _ := tbtypes.HexStringToUint128(debitAccountId)
-	creditAccountIdCasted, _ := tbtypes.HexStringToUint128(creditAccountId)
-	transferId, _ := tbtypes.HexStringToUint128(strconv.FormatInt(time.Now().Unix(), 10))
-
-	transfer := tbtypes.Transfer{
-		ID:              transferId,
-		DebitAccountID:  debitAccountIdCasted,
-		CreditAccountID: creditAccountIdCasted,
-		Amount:          amount,
-		Ledger:          1,
-		Code:            1,
+func (s *Service) Transfer(ctx context.Context, debitAccountId string, creditAccountId string, amount uint64, params *TransferParams) (*TransferResponse, error) {
+	request := []interface{}{"transfer", debitAccountId, creditAccountId, amount, params.Currency}
+	return idempotent(ctx, s.idempotencyKeys, params.IdempotencyKey, request, func(requestKey string) (*TransferResponse, error) {
+		return s.transfer(ctx, debitAccountId, creditAccountId, amount, params, requestKey)
+	})
+}
+
+func (s *Service) transfer(ctx context.Context, debitAccountId string, creditAccountId string, amount uint64, params *TransferParams, requestKey string) (*TransferResponse, error) {
+	err := checkAmount("amount", amount)
+	if err != nil {
+		return nil, err
+	}
+	debitAccountIdCasted, err := parseId("debitAccountId", debitAccountId)
+	if err != nil {
+		return nil, err
+	}
+	creditAccountIdCasted, err := parseId("creditAccountId", creditAccountId)
+	if err != nil {
+		return nil, err
 	}
+	accounts, err := s.ledger.LookupAccounts([]tbtypes.Uint128{debitAccountIdCasted, creditAccountIdCasted})
+	if err != nil {
+		rlog.Error("failed to fetch accounts", "error", err)
+		return nil, err
+	}
+	currency, err := s.transferCurrency(params.Currency, debitAccountIdCasted, accounts)
+	if err != nil {
+		return nil, err
+	}
+	transfer := newTransfer(requestTransferId(requestKey, 0), debitAccountIdCasted, creditAccountIdCasted, amount, currency.Ledger)
 
-	res, err := s.tbClient.CreateTransfers([]tbtypes.Transfer{transfer})
+	res, err := ledger.CreateTransfersOnce(s.ledger, []tbtypes.Transfer{transfer})
 	if err != nil {
 		rlog.Error("failed to create transfer", "error", err)
 		return nil, err
 	}
 
-	for _, r := range res {
-		rlog.Info("result " + r.Result.String())
+	if len(res) > 0 {
+		rlog.Info("transfer not created", "result", res[0].Result.String())
+		return nil, ledger.TransferError(res[0].Result)
 	}
 
 	return &TransferResponse{
-		DebitAccountId:  debitAccountId,
-		CreditAccountId: creditAccountId,
+		TransferId:      transfer.ID.String(),
+		DebitAccountId:  debitAccountIdCasted.String(),
+		CreditAccountId: creditAccountIdCasted.String(),
 		Amount:          amount,
+		Currency:        currency.Code,
 	}, nil
 }
 
-//encore:api public method=GET path=/transfer/:transferId
-func (s *Service) GetTransfer(ctx context.Context, transferId string) (*TransferResponse, error) {
-	transferIdCasted, _ := tbtypes.HexStringToUint128(transferId)
-	var transfers []tbtypes.Uint128
-	transfers = append(transfers, transferIdCasted)
+// transferCurrency is the currency of a transfer between accounts, code if it
+// is set or the debit account's currency. Transfers can't move funds between
+// currencies, the accounts must both be in it.
+func (s *Service) transferCurrency(code string, debitAccountId tbtypes.Uint128, accounts []tbtypes.Account) (ledger.Currency, error) {
+	currency, err := s.lookupCurrency("Currency", code)
+	if err != nil {
+		return ledger.Currency{}, err
+	}
+	if code == "" {
+		for _, account := range accounts {
+			if account.ID == debitAccountId {
+				currency = s.ledgerCurrency(account.Ledger)
+			}
+		}
+	}
+	// Missing accounts are left to the ledger to report.
+	for _, account := range accounts {
+		if account.Ledger != currency.Ledger {
+			return ledger.Currency{}, &errs.Error{
+				Code:    errs.InvalidArgument,
+				Message: fmt.Sprintf("account %s is in %s, not %s: transfers between currencies are not supported", account.ID, s.ledgerCurrency(account.Ledger).Code, currency.Code),
+			}
+		}
+	}
+	return currency, nil
+}
 
-	transfer, err := s.tbClient.LookupTransfers(transfers)
+// newTransfer is a transfer of amount on a ledger, see requestTransferId for
+// its ID.
+func newTransfer(id tbtypes.Uint128, debitAccountId tbtypes.Uint128, creditAccountId tbtypes.Uint128, amount uint64, ledgerId uint32) tbtypes.Transfer {
+	return tbtypes.Transfer{
+		ID:              id,
+		DebitAccountID:  debitAccountId,
+		CreditAccountID: creditAccountId,
+		Amount:          amount,
+		Ledger:          ledgerId,
+		Code:            ledger.TransferCode,
+	}
+}
+
+type TransferFlags struct {
+	Linked              bool
+	Pending             bool
+	PostPendingTransfer bool
+	VoidPendingTransfer bool
+}
+
+type TransferDetails struct {
+	TransferId      string
+	DebitAccountId  string
+	CreditAccountId string
+	Amount          uint64
+	Currency        string
+	Ledger          uint32
+	Code            uint16
+	Flags           TransferFlags
+	// PendingId is the pending transfer posted or voided by this transfer.
+	PendingId string
+	UserData  string
+	// Timeout is how long a pending transfer holds its amount, in nanoseconds.
+	Timeout uint64
+	// Timestamp is the time the ledger created the transfer, in nanoseconds
+	// since the epoch.
+	Timestamp uint64
+	// Status is "pending", "posted", "voided" or "expired". Only pending
+	// transfers become posted, voided or expired later on.
+	Status string
+	// ResolvedBy is the transfer that posted or voided a pending transfer.
+	ResolvedBy string
+	// Fx describes the FX transfer the transfer is a leg of, if any.
+	Fx *FxDetails
+}
+
+//encore:api public method=GET path=/transfer/:transferId
+func (s *Service) GetTransfer(ctx context.Context, transferId string) (*TransferDetails, error) {
+	transferIdCasted, err := parseId("transferId", transferId)
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := s.ledger.LookupTransfers([]tbtypes.Uint128{transferIdCasted})
 	if err != nil {
 		rlog.Error("failed to get transfer", "error", err)
 		return nil, err
 	}
+	if len(transfers) == 0 {
+		return nil, &errs.Error{Code: errs.NotFound, Message: "transfer not found"}
+	}
+	transfer := transfers[0]
 
-	if len(transfer) == 0 {
-		rlog.Info("transfer not found")
-		return nil, nil
+	var resolution *tbtypes.Transfer
+	flags := ledger.DecodeTransferFlags(transfer.Flags)
+	if flags.Pending {
+		resolvedBy, found, err := s.journal.LookupResolution(ctx, transfer.ID)
+		if err != nil {
+			rlog.Error("failed to get transfer resolution", "error", err)
+			return nil, err
+		}
+		if found {
+			resolution = &resolvedBy
+		}
 	}
+	details := s.newTransferDetails(transfer, resolution)
 
-	rlog.Info("transfer found " + transfer[0].ID.String() + " " + strconv.Itoa(int(transfer[0].Flags)) + " " + strconv.Itoa(int(transfer[0].Timestamp)))
+	fx, found, err := lookupFxDetails(ctx, transfer.ID)
+	if err != nil {
+		rlog.Error("failed to get FX transfer", "error", err)
+		return nil, err
+	}
+	if found {
+		details.Fx = &fx
+	}
+	return details, nil
+}
 
-	return nil, nil
+// newTransferDetails describes a transfer, resolution is the transfer that
+// posted or voided it if it is pending.
+func (s *Service) newTransferDetails(transfer tbtypes.Transfer, resolution *tbtypes.Transfer) *TransferDetails {
+	flags := ledger.DecodeTransferFlags(transfer.Flags)
+	details := &TransferDetails{
+		TransferId:      transfer.ID.String(),
+		DebitAccountId:  transfer.DebitAccountID.String(),
+		CreditAccountId: transfer.CreditAccountID.String(),
+		Amount:          transfer.Amount,
+		Currency:        s.ledgerCurrency(transfer.Ledger).Code,
+		Ledger:          transfer.Ledger,
+		Code:            transfer.Code,
+		Flags: TransferFlags{
+			Linked:              flags.Linked,
+			Pending:             flags.Pending,
+			PostPendingTransfer: flags.PostPendingTransfer,
+			VoidPendingTransfer: flags.VoidPendingTransfer,
+		},
+		UserData:  transfer.UserData.String(),
+		Timeout:   transfer.Timeout,
+		Timestamp: transfer.Timestamp,
+		Status:    ledger.TransferStatus(transfer, resolution),
+	}
+	if transfer.PendingID != workflow.InvalidTransferId {
+		details.PendingId = transfer.PendingID.String()
+	}
+	if resolution != nil {
+		details.ResolvedBy = resolution.ID.String()
+	}
+	return details
 }
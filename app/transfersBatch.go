@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"encore.app/app/ledger"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"fmt"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+)
+
+type TransfersBatchParams struct {
+	IdempotencyKey string `header:"Idempotency-Key"`
+
+	// Transfers to create, at most ledger.MaxBatchSize.
+	Transfers []BatchTransfer
+}
+
+type BatchTransfer struct {
+	DebitAccountId  string
+	CreditAccountId string
+	Amount          uint64
+	// Linked chains the transfer to the next one. The transfers of a chain,
+	// e.g. the principal, fee and tax legs of a payment, are all created or
+	// none of them are. The last transfer of a chain is not linked.
+	Linked bool
+	// Currency is the ISO 4217 code of the amount's currency, which sets the
+	// ledger of the transfer. The accounts must both be in it. Defaults to the
+	// currency of Ledger if it is set, or to the default currency.
+	Currency string
+	Ledger   uint32
+	// Code defaults to 1.
+	Code uint16
+}
+
+type TransfersBatchResponse struct {
+	// Results has a result for each transfer, in the order they were given.
+	Results []BatchTransferResult
+}
+
+type BatchTransferResult struct {
+	TransferId string
+	Created    bool
+	// Error is the error code and Reason the ledger result for transfers that
+	// were not created, see ledger.TransferError. The other transfers of a
+	// failed chain have the reason "linked_event_failed".
+	Error  string
+	Reason string
+}
+
+//encore:api public method=POST path=/transfers/batch
+func (s *Service) TransfersBatch(ctx context.Context, params *TransfersBatchParams) (*TransfersBatchResponse, error) {
+	request := []interface{}{"transfers-batch", params}
+	return idempotent(ctx, s.idempotencyKeys, params.IdempotencyKey, request, func(requestKey string) (*TransfersBatchResponse, error) {
+		return s.createTransfersBatch(ctx, params, requestKey)
+	})
+}
+
+func (s *Service) createTransfersBatch(ctx context.Context, params *TransfersBatchParams, requestKey string) (*TransfersBatchResponse, error) {
+	if len(params.Transfers) == 0 || len(params.Transfers) > ledger.MaxBatchSize {
+		return nil, &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("Transfers must have between 1 and %d transfers", ledger.MaxBatchSize)}
+	}
+
+	transfers := make([]tbtypes.Transfer, len(params.Transfers))
+	for i, batchTransfer := range params.Transfers {
+		err := checkAmount(fmt.Sprintf("Transfers[%d].Amount", i), batchTransfer.Amount)
+		if err != nil {
+			return nil, err
+		}
+		debitAccountId, err := parseId(fmt.Sprintf("Transfers[%d].DebitAccountId", i), batchTransfer.DebitAccountId)
+		if err != nil {
+			return nil, err
+		}
+		creditAccountId, err := parseId(fmt.Sprintf("Transfers[%d].CreditAccountId", i), batchTransfer.CreditAccountId)
+		if err != nil {
+			return nil, err
+		}
+		currency, err := s.lookupCurrency(fmt.Sprintf("Transfers[%d].Currency", i), batchTransfer.Currency)
+		if err != nil {
+			return nil, err
+		}
+		ledgerId := currency.Ledger
+		if batchTransfer.Ledger != 0 {
+			if batchTransfer.Currency != "" && batchTransfer.Ledger != currency.Ledger {
+				return nil, &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("Transfers[%d].Ledger must be the ledger of Currency", i)}
+			}
+			ledgerId = batchTransfer.Ledger
+		}
+		transfers[i] = newTransfer(requestTransferId(requestKey, uint64(i)), debitAccountId, creditAccountId, batchTransfer.Amount, ledgerId)
+		if batchTransfer.Code != 0 {
+			transfers[i].Code = batchTransfer.Code
+		}
+		transfers[i].Flags = tbtypes.TransferFlags{Linked: batchTransfer.Linked}.ToUint16()
+	}
+
+	res, err := ledger.CreateTransfersOnce(s.ledger, transfers)
+	if err != nil {
+		rlog.Error("failed to create transfers", "error", err)
+		return nil, err
+	}
+	failures := map[uint32]tbtypes.CreateTransferResult{}
+	for _, r := range res {
+		failures[r.Index] = r.Result
+	}
+
+	response := &TransfersBatchResponse{Results: make([]BatchTransferResult, len(transfers))}
+	for i, transfer := range transfers {
+		result := BatchTransferResult{TransferId: transfer.ID.String(), Created: true}
+		if failure, failed := failures[uint32(i)]; failed {
+			result.Created = false
+			result.Error = ledger.TransferError(failure).Code.String()
+			result.Reason = ledger.TransferReason(failure)
+		}
+		response.Results[i] = result
+	}
+	return response, nil
+}
@@ -0,0 +1,282 @@
+package workflow
+
+import (
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/workflow"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	AccountSignal = "account-operation"
+
+	OperationAuthorize = "authorize"
+	OperationPresent   = "present"
+	OperationIncrement = "increment"
+	OperationVoid      = "void"
+	OperationExpire    = "expire"
+
+	// accountOperationsPerRun bounds the history of a single Account run
+	// before it continues as new.
+	accountOperationsPerRun = 500
+	accountIdleTimeout      = 24 * time.Hour
+)
+
+// AccountOperation is signalled to an Account workflow. Authorize and present
+// run as child workflows with RequestId as their workflow ID, so callers can
+// wait for the result once the operation has been processed.
+type AccountOperation struct {
+	Type      string
+	RequestId string
+	Amount    uint64
+	// Ledger is the ledger of the account, and CreditAccountId the account
+	// the authorization settles to, for authorizations. HoldDuration is how
+	// long authorizations and increments hold funds.
+	Ledger          uint32
+	CreditAccountId tbtypes.Uint128
+	HoldDuration    time.Duration
+	// Final marks the last capture of an authorization, see Present.
+	Final bool
+	// MerchantId is recorded on authorization, and a presentment must come
+	// from the same merchant as the authorization it captures.
+	MerchantId string
+	// MaxAmount bounds the authorizations a presentment without a reference
+	// can match.
+	MaxAmount uint64
+	// AuthorizationId is the authorization to present, increment, void
+	// (reverse) or expire.
+	AuthorizationId tbtypes.Uint128
+	// TransferId is the pending transfer whose hold duration has elapsed, for
+	// expiries.
+	TransferId tbtypes.Uint128
+}
+
+// AccountState is carried across continue-as-new. Holds maps the
+// authorization IDs of the account's open authorizations to the pending
+// transfer currently holding their funds.
+type AccountState struct {
+	Holds map[string]Hold
+}
+
+type Hold struct {
+	TransferId tbtypes.Uint128
+	Amount     uint64
+	// ExpiryId is the pending transfer whose Void workflow expires the hold.
+	// It changes when the authorization is incremented.
+	ExpiryId   tbtypes.Uint128
+	MerchantId string
+}
+
+type PresentResult struct {
+	Matched bool
+	// TransferId is the pending transfer the presentment was posted against.
+	TransferId tbtypes.Uint128
+	CaptureResult
+}
+
+func AccountWorkflowId(accountId tbtypes.Uint128) string {
+	return "account-" + accountId.String()
+}
+
+// Account is a long-lived workflow, one per account, that processes
+// authorizations, presentments, voids and expiries one at a time in the order
+// they were signalled.
+func Account(ctx workflow.Context, accountId tbtypes.Uint128, state AccountState) error {
+	if state.Holds == nil {
+		state.Holds = map[string]Hold{}
+	}
+	options := workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 5,
+	}
+	ctx = workflow.WithActivityOptions(ctx, options)
+	operations := workflow.GetSignalChannel(ctx, AccountSignal)
+
+	for processed := 0; processed < accountOperationsPerRun; processed++ {
+		var operation AccountOperation
+		received := false
+		idle := false
+
+		timerCtx, cancelTimer := workflow.WithCancel(ctx)
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(operations, func(c workflow.ReceiveChannel, _ bool) {
+			c.Receive(ctx, &operation)
+			received = true
+		})
+		selector.AddFuture(workflow.NewTimer(timerCtx, accountIdleTimeout), func(f workflow.Future) {
+			idle = f.Get(ctx, nil) == nil
+		})
+		selector.Select(ctx)
+		cancelTimer()
+
+		if received {
+			processAccountOperation(ctx, accountId, operation, &state)
+		} else if idle && len(state.Holds) == 0 {
+			drainAccountOperations(ctx, accountId, operations, &state)
+			if len(state.Holds) == 0 {
+				log.Printf("Account workflow for %s idle, exiting", accountId)
+				return nil
+			}
+		}
+	}
+
+	drainAccountOperations(ctx, accountId, operations, &state)
+	return workflow.NewContinueAsNewError(ctx, Account, accountId, state)
+}
+
+// otherMerchantsHolds are the pending transfers of the holds of authorizations
+// by merchants other than merchantId, which it can't present, in the order of
+// their authorization IDs so that the workflow is deterministic.
+func otherMerchantsHolds(holds map[string]Hold, merchantId string) []tbtypes.Uint128 {
+	var authorizationIds []string
+	for authorizationId, hold := range holds {
+		if hold.MerchantId != "" && hold.MerchantId != merchantId {
+			authorizationIds = append(authorizationIds, authorizationId)
+		}
+	}
+	sort.Strings(authorizationIds)
+	var transferIds []tbtypes.Uint128
+	for _, authorizationId := range authorizationIds {
+		transferIds = append(transferIds, holds[authorizationId].TransferId)
+	}
+	return transferIds
+}
+
+func drainAccountOperations(ctx workflow.Context, accountId tbtypes.Uint128, operations workflow.ReceiveChannel, state *AccountState) {
+	for {
+		var operation AccountOperation
+		if !operations.ReceiveAsync(&operation) {
+			return
+		}
+		processAccountOperation(ctx, accountId, operation, state)
+	}
+}
+
+func processAccountOperation(ctx workflow.Context, accountId tbtypes.Uint128, operation AccountOperation, state *AccountState) {
+	// Request IDs derived from an idempotency key repeat when a request is
+	// retried, rejecting duplicates leaves the caller with the first result.
+	childCtx := workflow.WithChildOptions(ctx, workflow.ChildWorkflowOptions{
+		WorkflowID:            operation.RequestId,
+		WorkflowIDReusePolicy: enums.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE,
+	})
+
+	switch operation.Type {
+	case OperationAuthorize:
+		var transferId tbtypes.Uint128
+		err := workflow.ExecuteChildWorkflow(childCtx, Auth, accountId, operation.Amount, AuthOptions{
+			Ledger:          operation.Ledger,
+			CreditAccountId: operation.CreditAccountId,
+			HoldDuration:    operation.HoldDuration,
+		}).Get(ctx, &transferId)
+		if err != nil {
+			log.Printf("Authorization %s for account %s failed: %s", operation.RequestId, accountId, err)
+			return
+		}
+		if transferId != InvalidTransferId {
+			state.Holds[transferId.String()] = Hold{TransferId: transferId, Amount: operation.Amount, ExpiryId: transferId, MerchantId: operation.MerchantId}
+		}
+	case OperationPresent:
+		presentOptions := PresentOptions{
+			Final:           operation.Final,
+			AuthorizationId: operation.AuthorizationId,
+			TransferId:      InvalidTransferId,
+			MaxAmount:       operation.MaxAmount,
+		}
+		if operation.AuthorizationId != InvalidTransferId {
+			hold, ok := state.Holds[operation.AuthorizationId.String()]
+			switch {
+			case !ok:
+				// Authorizations placed before the account had an Account
+				// workflow are matched against the ledger.
+				presentOptions.TransferId = operation.AuthorizationId
+			case hold.MerchantId != "" && hold.MerchantId != operation.MerchantId:
+				log.Printf("Presentment %s from merchant %q does not match authorization %s", operation.RequestId, operation.MerchantId, operation.AuthorizationId)
+			default:
+				presentOptions.TransferId = hold.TransferId
+			}
+		} else {
+			presentOptions.ExcludedTransferIds = otherMerchantsHolds(state.Holds, operation.MerchantId)
+		}
+		var result PresentResult
+		err := workflow.ExecuteChildWorkflow(childCtx, Present, accountId, operation.Amount, presentOptions).Get(ctx, &result)
+		if err != nil {
+			log.Printf("Presentment %s for account %s failed: %s", operation.RequestId, accountId, err)
+			return
+		}
+		if !result.Matched {
+			return
+		}
+		key := result.AuthorizationId.String()
+		if result.PendingTransferId == InvalidTransferId {
+			delete(state.Holds, key)
+		} else {
+			hold, ok := state.Holds[key]
+			if !ok {
+				hold.ExpiryId = result.AuthorizationId
+			}
+			hold.TransferId = result.PendingTransferId
+			hold.Amount = result.RemainingAmount
+			state.Holds[key] = hold
+		}
+	case OperationIncrement:
+		key := operation.AuthorizationId.String()
+		hold, ok := state.Holds[key]
+		if !ok {
+			hold = Hold{TransferId: operation.AuthorizationId, ExpiryId: operation.AuthorizationId}
+		}
+		var result IncrementResult
+		err := workflow.ExecuteChildWorkflow(childCtx, Increment, accountId, operation.AuthorizationId, hold.TransferId, operation.Amount, operation.HoldDuration).Get(ctx, &result)
+		if err != nil {
+			log.Printf("Increment %s for account %s failed: %s", operation.RequestId, accountId, err)
+			return
+		}
+		if result.Incremented {
+			// The hold keeps its merchant.
+			hold.TransferId = result.TransferId
+			hold.Amount = result.HeldAmount
+			hold.ExpiryId = result.TransferId
+			state.Holds[key] = hold
+		}
+	case OperationVoid:
+		key := operation.AuthorizationId.String()
+		hold, ok := state.Holds[key]
+		if !ok {
+			hold = Hold{TransferId: operation.AuthorizationId, ExpiryId: operation.AuthorizationId}
+		}
+		var result ReverseResult
+		err := workflow.ExecuteChildWorkflow(childCtx, Reverse, accountId, operation.AuthorizationId, hold.TransferId, hold.ExpiryId, operation.Amount).Get(ctx, &result)
+		if err != nil {
+			log.Printf("Reversal %s for account %s failed: %s", operation.RequestId, accountId, err)
+			return
+		}
+		if !result.Reversed {
+			return
+		}
+		if result.TransferId == InvalidTransferId {
+			delete(state.Holds, key)
+		} else {
+			hold.TransferId = result.TransferId
+			hold.Amount = result.RemainingAmount
+			state.Holds[key] = hold
+		}
+	case OperationExpire:
+		key := operation.AuthorizationId.String()
+		transferId := operation.AuthorizationId
+		if hold, ok := state.Holds[key]; ok {
+			if hold.ExpiryId != operation.TransferId {
+				log.Printf("Ignoring superseded expiry of %s for authorization %s", operation.TransferId, operation.AuthorizationId)
+				return
+			}
+			transferId = hold.TransferId
+		}
+		err := voidIfPending(ctx, transferId)
+		if err != nil {
+			log.Printf("Could not expire authorization %s on account %s: %s", operation.AuthorizationId, accountId, err)
+			return
+		}
+		delete(state.Holds, key)
+	default:
+		log.Printf("Unknown operation %q for account %s", operation.Type, accountId)
+	}
+}
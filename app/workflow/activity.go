@@ -2,100 +2,136 @@ package workflow
 
 import (
 	"context"
+	"encore.app/app/ledger"
 	"fmt"
-	"github.com/go-redis/redis"
-	tb "github.com/tigerbeetledb/tigerbeetle-go"
 	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"go.temporal.io/sdk/temporal"
 	"log"
-	"strconv"
+	"math/big"
 	"time"
 )
 
 type Activities struct {
-	RedisClient *redis.Client
-	TbClient    tb.Client
+	Ledger         ledger.Ledger
+	Authorizations AuthorizationStore
 }
 
-func generateTransferId(accountId tbtypes.Uint128) tbtypes.Uint128 {
-	transferId, err := tbtypes.HexStringToUint128(strconv.FormatInt(time.Now().Unix(), 10))
-	if err != nil {
-		log.Printf("Could not generate transfer id: %s", err)
+// TransferIds are the IDs of the transfers an activity creates. Workflows
+// generate them once, see newTransferIds, so that a retried activity creates
+// the same transfers rather than new ones.
+type TransferIds struct {
+	// Transfer posts or voids a pending transfer.
+	Transfer tbtypes.Uint128
+	// Hold is a pending transfer placing or replacing a hold.
+	Hold tbtypes.Uint128
+}
+
+// transferFailure is the error for a batch with failed results. It is a
+// non-retryable application error, as retrying would fail the same way, whose
+// type is the result's reason and whose details are the API error code.
+func transferFailure(res []tbtypes.TransferEventResult) error {
+	failure := res[0].Result
+	for _, r := range res {
+		if r.Result != tbtypes.TransferLinkedEventFailed {
+			failure = r.Result
+			break
+		}
 	}
-	//log.Printf("Transfer id generated for account %s: %s", accountId, transferId)
-	return transferId
+	log.Printf("Transfer batch failed: %s", failure)
+	err := ledger.TransferError(failure)
+	return temporal.NewNonRetryableApplicationError(err.Message, ledger.TransferReason(failure), nil, int(err.Code))
 }
 
-func storeAuthorizationRedis(debitAccountId tbtypes.Uint128, amount uint64, transferId tbtypes.Uint128, redisClient *redis.Client) {
-	redisClient.RPush("authorizations:"+debitAccountId.String()+":amounts:"+strconv.Itoa(int(amount))+":transfers", transferId.String())
+// declined reports whether the ledger refused a hold because the account does
+// not exist or its balance does not cover it. The ledger checks the balance,
+// pending debits included, as it creates the hold, so concurrent holds can't
+// overcommit an account that must not be overdrawn.
+func declined(res []tbtypes.TransferEventResult) bool {
+	for _, r := range res {
+		switch r.Result {
+		case tbtypes.TransferExceedsCredits, tbtypes.TransferDebitAccountNotFound:
+			return true
+		}
+	}
+	return false
 }
 
-func getAuthorizationRedis(debitAccountId tbtypes.Uint128, amount uint64, redisClient *redis.Client) ([]tbtypes.Uint128, error) {
-	key := fmt.Sprintf("authorizations:%s:amounts:%d:transfers", debitAccountId, amount)
-	log.Printf("Checking authorizations for Key: %s", key)
-	transfers, err := redisClient.LRange(key, 0, -1).Result()
-	if err != nil {
-		log.Printf("Could not get authorization from redis: %s", err)
-		return nil, err
+// covers reports whether an account's available balance covers a hold of
+// amount. The ledger enforces it for accounts whose debits must not exceed
+// their credits, so those aren't checked. Accounts without the flag, created
+// before it was set by default or with it turned off, are checked here. Holds
+// on an account are placed one at a time by its Account workflow, so they
+// can't race each other past the check.
+func covers(l ledger.Ledger, accountId tbtypes.Uint128, amount uint64) (bool, error) {
+	accounts, err := l.LookupAccounts([]tbtypes.Uint128{accountId})
+	if err != nil || len(accounts) == 0 {
+		return false, err
 	}
-	var returnTransfers []tbtypes.Uint128
-	for _, transfer := range transfers {
-		tid, _ := tbtypes.HexStringToUint128(transfer)
-		returnTransfers = append(returnTransfers, tid)
+	debitsFlag := tbtypes.AccountFlags{DebitsMustNotExceedCredits: true}.ToUint16()
+	if accounts[0].Flags&debitsFlag != 0 {
+		return true, nil
 	}
-	return returnTransfers, nil
+	available := ledger.NewBalance(accounts[0]).OverdraftAdjusted
+	return available.Cmp(new(big.Int).SetUint64(amount)) >= 0, nil
+}
+
+// live reports whether a transfer is a hold that can still be posted or
+// voided. Holds are expired by their Void workflow, see newHold, except those
+// placed with a ledger timeout, which the ledger expires.
+func live(transfer tbtypes.Transfer) bool {
+	pendingFlag := tbtypes.TransferFlags{Pending: true}.ToUint16()
+	return transfer.Flags == pendingFlag && voidable(transfer)
 }
 
-func voidAuthorization(transferId tbtypes.Uint128, tbClient tb.Client) error {
+// voidable reports whether the ledger still accepts a void of a pending
+// transfer, that is whether it has no ledger timeout or it has not elapsed.
+func voidable(transfer tbtypes.Transfer) bool {
+	return transfer.Timeout == 0 || transfer.Timestamp+transfer.Timeout > uint64(time.Now().UnixNano())
+}
+
+func voidAuthorization(id tbtypes.Uint128, transferId tbtypes.Uint128, l ledger.Ledger) error {
 	transfer := tbtypes.Transfer{
-		ID: generateTransferId(transferId),
+		ID: id,
 		Flags: tbtypes.TransferFlags{
 			VoidPendingTransfer: true,
 		}.ToUint16(),
 		PendingID: transferId,
 	}
-	res, err := tbClient.CreateTransfers([]tbtypes.Transfer{transfer})
+	res, err := ledger.CreateTransfersOnce(l, []tbtypes.Transfer{transfer})
 	if err != nil {
 		log.Printf("Error creating transfer batch %s", err)
 		return err
 	}
-	for _, t := range res {
-		id := int(t.Index)
-		log.Printf("Transfer %s created %d : id", t.Result, id)
-	}
-	return nil
-}
-
-func removeVoidAuthorizationRedis(debitAccountId tbtypes.Uint128, amount uint64, transferId tbtypes.Uint128, redisClient *redis.Client) error {
-	key := fmt.Sprintf("authorizations:%s:amounts:%d:transfers", debitAccountId, amount)
-	err := redisClient.LRem(key, 0, transferId.String()).Err()
-	if err != nil {
-		log.Printf("Could not remove authorization from redis: %s", err)
-		return err
+	if len(res) > 0 {
+		return transferFailure(res)
 	}
 	return nil
 }
 
-func postPendingAuthorization(accountId tbtypes.Uint128, pendingId tbtypes.Uint128, tbClient tb.Client) error {
+// postPendingAuthorization posts amount of a pending transfer, releasing
+// whatever is left of the hold.
+func postPendingAuthorization(id tbtypes.Uint128, pendingId tbtypes.Uint128, amount uint64, l ledger.Ledger) error {
 	transfer := tbtypes.Transfer{
-		ID:        generateTransferId(accountId),
+		ID:        id,
 		PendingID: pendingId,
+		Amount:    amount,
 		Flags: tbtypes.TransferFlags{
 			PostPendingTransfer: true,
 		}.ToUint16(),
 	}
-	res, err := tbClient.CreateTransfers([]tbtypes.Transfer{transfer})
+	res, err := ledger.CreateTransfersOnce(l, []tbtypes.Transfer{transfer})
 	if err != nil {
 		log.Printf("Error creating transfer batch %s", err)
 		return err
 	}
-	for _, t := range res {
-		log.Printf("Transfer %s created", t.Result)
+	if len(res) > 0 {
+		return transferFailure(res)
 	}
 	return nil
 }
 
 func (a *Activities) CheckAccountExists(_ context.Context, accountId tbtypes.Uint128) (bool, error) {
-	accounts, err := a.TbClient.LookupAccounts([]tbtypes.Uint128{accountId})
+	accounts, err := a.Ledger.LookupAccounts([]tbtypes.Uint128{accountId})
 	if err != nil {
 		log.Printf("Could not fetch accounts: %s", err)
 		return false, err
@@ -106,109 +142,381 @@ func (a *Activities) CheckAccountExists(_ context.Context, accountId tbtypes.Uin
 	return true, nil
 }
 
-func (a *Activities) CheckAccountExistsWithSufficientBalance(_ context.Context, accountId tbtypes.Uint128, amount uint64) (bool, error) {
-	accounts, err := a.TbClient.LookupAccounts([]tbtypes.Uint128{accountId})
+// newHold is a pending transfer of amount on a ledger. It has no ledger
+// timeout: the TigerBeetle release the service is built against does not
+// release the amount of a pending transfer whose timeout elapses, so a hold
+// left to expire in the ledger would stay held for good. The Void workflow
+// voids it instead.
+func newHold(id tbtypes.Uint128, debitAccountId tbtypes.Uint128, creditAccountId tbtypes.Uint128, amount uint64, ledgerId uint32) tbtypes.Transfer {
+	return tbtypes.Transfer{
+		ID:              id,
+		DebitAccountID:  debitAccountId,
+		CreditAccountID: creditAccountId,
+		Amount:          amount,
+		Flags: tbtypes.TransferFlags{
+			Pending: true,
+		}.ToUint16(),
+		Ledger: ledgerId,
+		Code:   ledger.TransferCode,
+	}
+}
+
+// remainingHold replaces pending with a hold of amount for the same
+// authorization.
+func remainingHold(id tbtypes.Uint128, pending tbtypes.Transfer, authorizationId tbtypes.Uint128, amount uint64) tbtypes.Transfer {
+	hold := newHold(id, pending.DebitAccountID, pending.CreditAccountID, amount, pending.Ledger)
+	hold.UserData = authorizationId
+	hold.Code = pending.Code
+	return hold
+}
+
+func (a *Activities) PlaceAuthorization(ctx context.Context, ids TransferIds, debitAccountId tbtypes.Uint128, amount uint64, options AuthOptions) (tbtypes.Uint128, error) {
+	if options.Ledger == 0 {
+		return InvalidTransferId, temporal.NewNonRetryableApplicationError("authorization has no ledger", "ledger_unknown", nil)
+	}
+	covered, err := covers(a.Ledger, debitAccountId, amount)
 	if err != nil {
-		log.Printf("Could not fetch accounts: %s", err)
-		return false, err
+		log.Printf("Could not fetch account: %s", err)
+		return InvalidTransferId, err
 	}
-	if len(accounts) == 0 {
-		return false, nil
+	if !covered {
+		log.Printf("Authorization of %d on account %s declined: balance does not cover it", amount, debitAccountId)
+		return InvalidTransferId, nil
 	}
-	var account tbtypes.Account
-	for _, acc := range accounts {
-		account = acc
-		break
+	transfer := newHold(ids.Hold, debitAccountId, options.CreditAccountId, amount, options.Ledger)
+	// Holds that replace this one after a partial capture or an increment
+	// carry the original transfer ID as the authorization ID.
+	transfer.UserData = transfer.ID
+	res, err := ledger.CreateTransfersOnce(a.Ledger, []tbtypes.Transfer{transfer})
+	if err != nil {
+		log.Printf("Error creating transfer batch %s", err)
+		return InvalidTransferId, err
 	}
-	if account.CreditsPosted-account.DebitsPosted < amount {
-		return false, nil
+	if declined(res) {
+		log.Printf("Authorization of %d on account %s declined: %s", amount, debitAccountId, res[0].Result)
+		return InvalidTransferId, nil
 	}
-	return true, nil
+	if len(res) > 0 {
+		return InvalidTransferId, transferFailure(res)
+	}
+	err = a.Authorizations.StoreAuthorization(ctx, debitAccountId, amount, transfer.ID)
+	if err != nil {
+		log.Printf("Could not store authorization: %s", err)
+	}
+	return transfer.ID, nil
 }
 
-func (a *Activities) PlaceAuthorization(_ context.Context, debitAccountId tbtypes.Uint128, creditAccountId tbtypes.Uint128, amount uint64) (tbtypes.Uint128, error) {
-	transfer := tbtypes.Transfer{
-		ID:              generateTransferId(debitAccountId),
-		DebitAccountID:  debitAccountId,
-		CreditAccountID: creditAccountId,
-		Amount:          amount,
+// IncrementAuthorization raises the hold of an authorization by amount. The
+// pending transfer currently holding it is voided and replaced, in the same
+// linked chain, by one for the new total. It returns an
+// InvalidTransferId authorization if the hold is no longer pending, or if the
+// increment is declined.
+func (a *Activities) IncrementAuthorization(ctx context.Context, ids TransferIds, authorizationId tbtypes.Uint128, transferId tbtypes.Uint128, debitAccountId tbtypes.Uint128, amount uint64) (Authorization, error) {
+	noHold := Authorization{TransferId: InvalidTransferId}
+	transfers, err := a.Ledger.LookupTransfers([]tbtypes.Uint128{transferId})
+	if err != nil {
+		log.Printf("Could not fetch transfer: %s", err)
+		return noHold, err
+	}
+	if len(transfers) == 0 || !live(transfers[0]) {
+		return noHold, nil
+	}
+	pending := transfers[0]
+	if pending.Amount+amount > ledger.MaxAmount {
+		log.Printf("Increment of %d on authorization %s declined: the hold would exceed the largest amount", amount, authorizationId)
+		return noHold, nil
+	}
+	// The void releases the current hold, so only amount needs covering.
+	covered, err := covers(a.Ledger, debitAccountId, amount)
+	if err != nil {
+		log.Printf("Could not fetch account: %s", err)
+		return noHold, err
+	}
+	if !covered {
+		log.Printf("Increment of %d on authorization %s declined: balance does not cover it", amount, authorizationId)
+		return noHold, nil
+	}
+
+	void := tbtypes.Transfer{
+		ID:        ids.Transfer,
+		PendingID: pending.ID,
 		Flags: tbtypes.TransferFlags{
-			Pending: true,
+			Linked:              true,
+			VoidPendingTransfer: true,
 		}.ToUint16(),
-		//Timeout: uint64(AuthorizationHoldDuration.Nanoseconds()), TODO: check why this isn't working as expeceted
-		Ledger: 1,
-		Code:   1,
 	}
-	res, err := a.TbClient.CreateTransfers([]tbtypes.Transfer{transfer})
+	hold := remainingHold(ids.Hold, pending, authorizationId, pending.Amount+amount)
+	res, err := ledger.CreateTransfersOnce(a.Ledger, []tbtypes.Transfer{void, hold})
 	if err != nil {
 		log.Printf("Error creating transfer batch %s", err)
-		return InvalidTransferId, err
+		return noHold, err
 	}
-	for _, t := range res {
-		id := int(t.Index)
-		log.Printf("Transfer %s created %d : id", t.Result, id)
+	if declined(res) {
+		log.Printf("Increment of %d on authorization %s declined", amount, authorizationId)
+		return noHold, nil
 	}
-	storeAuthorizationRedis(debitAccountId, amount, transfer.ID, a.RedisClient)
-	return transfer.ID, nil
+	if len(res) > 0 {
+		return noHold, transferFailure(res)
+	}
+
+	err = a.Authorizations.StoreAuthorization(ctx, debitAccountId, hold.Amount, hold.ID)
+	if err != nil {
+		log.Printf("Could not store authorization: %s", err)
+	}
+	err = a.Authorizations.RemoveAuthorization(ctx, debitAccountId, pending.Amount, pending.ID)
+	if err != nil {
+		log.Printf("Could not remove authorization: %s", err)
+	}
+	return Authorization{TransferId: hold.ID, Amount: hold.Amount}, nil
 }
 
-func (a *Activities) MatchPresentment(_ context.Context, debitAccountId tbtypes.Uint128, amount uint64) (tbtypes.Uint128, error) {
-	authorizations, err := getAuthorizationRedis(debitAccountId, amount, a.RedisClient)
-	log.Printf("got authorizations: %s", authorizations)
+// MatchAuthorization checks that a referenced pending transfer is live, debits
+// the account and covers amount.
+func (a *Activities) MatchAuthorization(_ context.Context, transferId tbtypes.Uint128, debitAccountId tbtypes.Uint128, amount uint64) (Authorization, error) {
+	noMatch := Authorization{TransferId: InvalidTransferId}
+	transfers, err := a.Ledger.LookupTransfers([]tbtypes.Uint128{transferId})
 	if err != nil {
-		log.Printf("Could not get authorization from redis: %s", err)
-		return InvalidTransferId, err
+		log.Printf("Could not fetch transfer: %s", err)
+		return noMatch, err
+	}
+	if len(transfers) == 0 {
+		log.Printf("transfer %s not found in ledger", transferId)
+		return noMatch, nil
+	}
+	transfer := transfers[0]
+	if !live(transfer) {
+		log.Printf("transfer %s is no longer pending", transferId)
+		return noMatch, nil
+	}
+	if transfer.DebitAccountID != debitAccountId || transfer.Amount < amount {
+		log.Printf("transfer %s does not cover %d on account %s", transferId, amount, debitAccountId)
+		return noMatch, nil
+	}
+	return Authorization{TransferId: transfer.ID, Amount: transfer.Amount}, nil
+}
+
+// MatchPresentment finds the smallest live authorization on the account that
+// covers amount, ignoring authorizations of more than maxAmount and those held
+// by the pending transfers in excludedTransferIds. Holds stay live until their
+// Void workflow voids them, authorizations it comes across that are gone from
+// the ledger, or expired in it, are removed.
+func (a *Activities) MatchPresentment(ctx context.Context, debitAccountId tbtypes.Uint128, amount uint64, maxAmount uint64, excludedTransferIds []tbtypes.Uint128) (Authorization, error) {
+	noMatch := Authorization{TransferId: InvalidTransferId}
+	log.Printf("Checking authorizations for account %s and amount %d", debitAccountId, amount)
+	authorizations, err := a.Authorizations.GetAuthorizations(ctx, debitAccountId, amount)
+	log.Printf("got authorizations: %+v", authorizations)
+	if err != nil {
+		log.Printf("Could not get authorizations: %s", err)
+		return noMatch, err
+	}
+	excluded := map[tbtypes.Uint128]bool{}
+	for _, transferId := range excludedTransferIds {
+		excluded[transferId] = true
 	}
+	var candidates []Authorization
+	for _, authorization := range authorizations {
+		if authorization.Amount > maxAmount {
+			break
+		}
+		if !excluded[authorization.TransferId] {
+			candidates = append(candidates, authorization)
+		}
+	}
+	authorizations = candidates
 	if len(authorizations) == 0 {
 		log.Printf("no authorizations found")
-		return InvalidTransferId, nil
+		return noMatch, nil
 	}
 
-	transfers, err := a.TbClient.LookupTransfers(authorizations)
+	var transferIds []tbtypes.Uint128
+	for _, authorization := range authorizations {
+		transferIds = append(transferIds, authorization.TransferId)
+	}
+	transfers, err := a.Ledger.LookupTransfers(transferIds)
 	if err != nil {
 		log.Printf("Could not fetch transfers: %s", err)
-		return InvalidTransferId, err
+		return noMatch, err
 	}
-	log.Printf("got transfers from tb: %s", transfers)
-	pendingFlag := tbtypes.TransferFlags{Pending: true}.ToUint16()
+	log.Printf("got transfers from tb: %+v", transfers)
+	transfersById := map[tbtypes.Uint128]tbtypes.Transfer{}
 	for _, transfer := range transfers {
-		log.Printf("checking for transfer: %s", transfer)
-		if transfer.Flags == pendingFlag && transfer.Timestamp+uint64(AuthorizationHoldDuration.Nanoseconds()) > uint64(time.Now().UnixNano()) {
-			log.Printf("pending transfer: %s", transfer)
-			return transfer.ID, nil
+		transfersById[transfer.ID] = transfer
+	}
+
+	for _, authorization := range authorizations {
+		transfer, ok := transfersById[authorization.TransferId]
+		log.Printf("checking for transfer: %+v", transfer)
+		if ok && live(transfer) {
+			log.Printf("pending transfer: %+v", transfer)
+			return authorization, nil
+		}
+		if !ok {
+			log.Printf("transfer %s not found in ledger", authorization.TransferId)
 		} else {
-			log.Printf("voiding transfer: %s", transfer)
-			err = voidAuthorization(transfer.ID, a.TbClient)
-			if err != nil {
-				log.Printf("Could not void pending auth: %s", err)
-			}
-			err = removeVoidAuthorizationRedis(debitAccountId, amount, transfer.ID, a.RedisClient)
-			if err != nil {
-				log.Printf("Could not remove authorization from redis: %s", err)
-			}
+			log.Printf("transfer expired in ledger before it was voided, its amount stays pending: %+v", transfer)
+		}
+		err = a.Authorizations.RemoveAuthorization(ctx, debitAccountId, authorization.Amount, authorization.TransferId)
+		if err != nil {
+			log.Printf("Could not remove authorization: %s", err)
 		}
 	}
-	return InvalidTransferId, nil
+	return noMatch, nil
+}
+
+type CaptureResult struct {
+	// AuthorizationId is the ID of the authorization's first pending transfer.
+	AuthorizationId tbtypes.Uint128
+	CapturedAmount  uint64
+	ReleasedAmount  uint64
+	// PendingTransferId holds RemainingAmount for later captures, or is
+	// InvalidTransferId if nothing remains held.
+	PendingTransferId tbtypes.Uint128
+	RemainingAmount   uint64
 }
 
-func (a *Activities) PostPendingTransfer(_ context.Context, transferId, debitAccountId tbtypes.Uint128, amount uint64) error {
-	err := postPendingAuthorization(debitAccountId, transferId, a.TbClient)
+// PostPendingTransfer captures amount of an authorization. On a final capture,
+// or when the whole hold is captured, the ledger releases any remainder.
+// Otherwise the remainder is moved to a new pending transfer, linked with the
+// post so both happen atomically, which later captures can draw from.
+func (a *Activities) PostPendingTransfer(ctx context.Context, ids TransferIds, authorization Authorization, debitAccountId tbtypes.Uint128, amount uint64, final bool) (CaptureResult, error) {
+	lookup := []tbtypes.Uint128{authorization.TransferId}
+	transfers, err := a.Ledger.LookupTransfers(lookup)
 	if err != nil {
-		log.Printf("Error in postPendingAuthorization: %s for transfer: %s, continuing", err, transferId)
-		return err
+		log.Printf("Could not fetch transfer: %s", err)
+		return CaptureResult{}, err
+	}
+	if len(transfers) == 0 {
+		return CaptureResult{}, fmt.Errorf("pending transfer %s not found", authorization.TransferId)
+	}
+	pending := transfers[0]
+	// The ledger posts the whole pending amount for a zero amount.
+	switch {
+	case amount == 0:
+		return CaptureResult{}, transferFailure([]tbtypes.TransferEventResult{{Result: tbtypes.TransferAmountMustNotBeZero}})
+	case amount > pending.Amount:
+		return CaptureResult{}, transferFailure([]tbtypes.TransferEventResult{{Result: tbtypes.TransferExceedsPendingTransferAmount}})
 	}
-	err = removeVoidAuthorizationRedis(debitAccountId, amount, transferId, a.RedisClient)
+
+	result := CaptureResult{
+		AuthorizationId:   pending.UserData,
+		CapturedAmount:    amount,
+		PendingTransferId: InvalidTransferId,
+	}
+	if result.AuthorizationId == InvalidTransferId {
+		result.AuthorizationId = pending.ID
+	}
+
+	if final || amount == pending.Amount {
+		err = postPendingAuthorization(ids.Transfer, pending.ID, amount, a.Ledger)
+		if err != nil {
+			log.Printf("Error in postPendingAuthorization: %s for transfer: %s, continuing", err, pending.ID)
+			return CaptureResult{}, err
+		}
+		result.ReleasedAmount = pending.Amount - amount
+	} else {
+		remaining := remainingHold(ids.Hold, pending, result.AuthorizationId, pending.Amount-amount)
+		post := tbtypes.Transfer{
+			ID:        ids.Transfer,
+			PendingID: pending.ID,
+			Amount:    amount,
+			Flags: tbtypes.TransferFlags{
+				Linked:              true,
+				PostPendingTransfer: true,
+			}.ToUint16(),
+		}
+		res, err := ledger.CreateTransfersOnce(a.Ledger, []tbtypes.Transfer{post, remaining})
+		if err != nil {
+			log.Printf("Error creating transfer batch %s", err)
+			return CaptureResult{}, err
+		}
+		if len(res) > 0 {
+			return CaptureResult{}, transferFailure(res)
+		}
+		result.PendingTransferId = remaining.ID
+		result.RemainingAmount = remaining.Amount
+		err = a.Authorizations.StoreAuthorization(ctx, debitAccountId, remaining.Amount, remaining.ID)
+		if err != nil {
+			log.Printf("Could not store authorization: %s", err)
+		}
+	}
+
+	err = a.Authorizations.RemoveAuthorization(ctx, debitAccountId, authorization.Amount, authorization.TransferId)
 	if err != nil {
-		log.Printf("Could not remove authorization from redis: %s", err)
+		log.Printf("Could not remove authorization: %s", err)
 	}
-	return nil
+	return result, nil
+}
+
+type ReverseResult struct {
+	Reversed       bool
+	ReversedAmount uint64
+	// TransferId holds RemainingAmount after a partial reversal, or is
+	// InvalidTransferId if the whole authorization was reversed.
+	TransferId      tbtypes.Uint128
+	RemainingAmount uint64
+}
+
+// ReverseAuthorization releases amount of an authorization's hold, or all of
+// it if amount is zero or covers the hold. A partial reversal voids the
+// pending transfer and, linked with the void, places one for the remainder.
+func (a *Activities) ReverseAuthorization(ctx context.Context, ids TransferIds, authorizationId tbtypes.Uint128, transferId tbtypes.Uint128, debitAccountId tbtypes.Uint128, amount uint64) (ReverseResult, error) {
+	transfers, err := a.Ledger.LookupTransfers([]tbtypes.Uint128{transferId})
+	if err != nil {
+		log.Printf("Could not fetch transfer: %s", err)
+		return ReverseResult{}, err
+	}
+	if len(transfers) == 0 || !live(transfers[0]) {
+		return ReverseResult{}, nil
+	}
+	pending := transfers[0]
+
+	result := ReverseResult{Reversed: true, TransferId: InvalidTransferId}
+	if amount == 0 || amount >= pending.Amount {
+		err = voidAuthorization(ids.Transfer, pending.ID, a.Ledger)
+		if err != nil {
+			log.Printf("Could not void pending auth: %s", err)
+			return ReverseResult{}, err
+		}
+		result.ReversedAmount = pending.Amount
+	} else {
+		void := tbtypes.Transfer{
+			ID:        ids.Transfer,
+			PendingID: pending.ID,
+			Flags: tbtypes.TransferFlags{
+				Linked:              true,
+				VoidPendingTransfer: true,
+			}.ToUint16(),
+		}
+		remaining := remainingHold(ids.Hold, pending, authorizationId, pending.Amount-amount)
+		res, err := ledger.CreateTransfersOnce(a.Ledger, []tbtypes.Transfer{void, remaining})
+		if err != nil {
+			log.Printf("Error creating transfer batch %s", err)
+			return ReverseResult{}, err
+		}
+		if len(res) > 0 {
+			return ReverseResult{}, transferFailure(res)
+		}
+		result.ReversedAmount = amount
+		result.TransferId = remaining.ID
+		result.RemainingAmount = remaining.Amount
+		err = a.Authorizations.StoreAuthorization(ctx, debitAccountId, remaining.Amount, remaining.ID)
+		if err != nil {
+			log.Printf("Could not store authorization: %s", err)
+		}
+	}
+
+	err = a.Authorizations.RemoveAuthorization(ctx, debitAccountId, pending.Amount, pending.ID)
+	if err != nil {
+		log.Printf("Could not remove authorization: %s", err)
+	}
+	return result, nil
 }
 
 func (a *Activities) IsPendingTransfer(_ context.Context, transferId tbtypes.Uint128) (bool, error) {
 	var transfers []tbtypes.Uint128
 	transfersList := append(transfers, transferId)
 
-	transfer, err := a.TbClient.LookupTransfers(transfersList)
+	transfer, err := a.Ledger.LookupTransfers(transfersList)
 	if err != nil {
 		log.Printf("Could not fetch transfer: %s", err)
 		return false, err
@@ -219,28 +527,36 @@ func (a *Activities) IsPendingTransfer(_ context.Context, transferId tbtypes.Uin
 		return false, nil
 	}
 
+	// A void rejected by the ledger tells whether anything is left to release.
 	pendingFlag := tbtypes.TransferFlags{Pending: true}.ToUint16()
-	if transfer[0].Flags == pendingFlag {
-		return true, nil
-	}
-	return false, nil
+	return transfer[0].Flags == pendingFlag, nil
 }
 
-func (a *Activities) VoidAuthorization(_ context.Context, transferId tbtypes.Uint128) error {
+func (a *Activities) VoidAuthorization(_ context.Context, ids TransferIds, transferId tbtypes.Uint128) error {
 	transfer := tbtypes.Transfer{
-		ID: generateTransferId(transferId),
+		ID: ids.Transfer,
 		Flags: tbtypes.TransferFlags{
 			VoidPendingTransfer: true,
 		}.ToUint16(),
 		PendingID: transferId,
 	}
-	res, err := a.TbClient.CreateTransfers([]tbtypes.Transfer{transfer})
+	res, err := ledger.CreateTransfersOnce(a.Ledger, []tbtypes.Transfer{transfer})
 	if err != nil {
 		log.Printf("Error creating transfer batch %s", err)
 		return err
 	}
 	for _, t := range res {
-		log.Printf("Transfer %s created %d : id", t.Result, transferId)
+		switch t.Result {
+		case tbtypes.TransferPendingTransferAlreadyPosted, tbtypes.TransferPendingTransferAlreadyVoided:
+			// Nothing is left to release.
+			log.Printf("Transfer %s no longer pending: %s", transferId, t.Result)
+		case tbtypes.TransferPendingTransferExpired:
+			// The ledger can't release a hold placed with a ledger timeout
+			// once it elapses.
+			log.Printf("Transfer %s expired in the ledger before it was voided, its amount stays pending", transferId)
+		default:
+			return transferFailure(res)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,193 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	AuthorizationStoreRedis  = "redis"
+	AuthorizationStoreMemory = "memory"
+	AuthorizationStoreSql    = "sql"
+)
+
+type Authorization struct {
+	TransferId tbtypes.Uint128
+	Amount     uint64
+}
+
+// AuthorizationStore indexes the pending transfers placed by Auth so that a
+// later presentment can find them by account and amount.
+type AuthorizationStore interface {
+	StoreAuthorization(ctx context.Context, debitAccountId tbtypes.Uint128, amount uint64, transferId tbtypes.Uint128) error
+	// GetAuthorizations returns the account's authorizations of at least
+	// minAmount, smallest amount first and oldest first within an amount.
+	GetAuthorizations(ctx context.Context, debitAccountId tbtypes.Uint128, minAmount uint64) ([]Authorization, error)
+	RemoveAuthorization(ctx context.Context, debitAccountId tbtypes.Uint128, amount uint64, transferId tbtypes.Uint128) error
+}
+
+// RedisAuthorizationStore keeps a list of transfers per account and amount,
+// and a set of the amounts that have authorizations per account.
+type RedisAuthorizationStore struct {
+	Client *redis.Client
+}
+
+func authorizationRedisKey(debitAccountId tbtypes.Uint128, amount uint64) string {
+	return fmt.Sprintf("authorizations:%s:amounts:%d:transfers", debitAccountId, amount)
+}
+
+func authorizationAmountsRedisKey(debitAccountId tbtypes.Uint128) string {
+	return fmt.Sprintf("authorizations:%s:amounts", debitAccountId)
+}
+
+func (r *RedisAuthorizationStore) StoreAuthorization(_ context.Context, debitAccountId tbtypes.Uint128, amount uint64, transferId tbtypes.Uint128) error {
+	_, err := r.Client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.RPush(authorizationRedisKey(debitAccountId, amount), transferId.String())
+		pipe.SAdd(authorizationAmountsRedisKey(debitAccountId), amount)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisAuthorizationStore) GetAuthorizations(_ context.Context, debitAccountId tbtypes.Uint128, minAmount uint64) ([]Authorization, error) {
+	members, err := r.Client.SMembers(authorizationAmountsRedisKey(debitAccountId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var amounts []uint64
+	for _, member := range members {
+		amount, err := strconv.ParseUint(member, 10, 64)
+		if err == nil && amount >= minAmount {
+			amounts = append(amounts, amount)
+		}
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i] < amounts[j] })
+
+	var authorizations []Authorization
+	for _, amount := range amounts {
+		transfers, err := r.Client.LRange(authorizationRedisKey(debitAccountId, amount), 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, transfer := range transfers {
+			tid, _ := tbtypes.HexStringToUint128(transfer)
+			authorizations = append(authorizations, Authorization{TransferId: tid, Amount: amount})
+		}
+	}
+	return authorizations, nil
+}
+
+// removeAuthorizationScript removes a transfer from the list of its amount,
+// and the amount from the account's amounts once the list is empty, as one
+// step so that a concurrent StoreAuthorization can't be left out of the set.
+var removeAuthorizationScript = redis.NewScript(`
+redis.call("LREM", KEYS[1], 0, ARGV[1])
+if redis.call("LLEN", KEYS[1]) == 0 then
+	redis.call("SREM", KEYS[2], ARGV[2])
+end
+return 0
+`)
+
+func (r *RedisAuthorizationStore) RemoveAuthorization(_ context.Context, debitAccountId tbtypes.Uint128, amount uint64, transferId tbtypes.Uint128) error {
+	keys := []string{authorizationRedisKey(debitAccountId, amount), authorizationAmountsRedisKey(debitAccountId)}
+	return removeAuthorizationScript.Run(r.Client, keys, transferId.String(), amount).Err()
+}
+
+// authorizationsMigratedRedisKey is set once Migrate has indexed the amounts of
+// the lists stored before the amounts were.
+const authorizationsMigratedRedisKey = "authorizations:migrated"
+
+// Migrate adds the amounts of the lists of transfers stored before the
+// amounts were indexed to the accounts' amounts, so that GetAuthorizations
+// finds them. It runs once, later calls return straight away.
+func (r *RedisAuthorizationStore) Migrate() error {
+	migrated, err := r.Client.Exists(authorizationsMigratedRedisKey).Result()
+	if err != nil || migrated > 0 {
+		return err
+	}
+	var cursor uint64
+	for {
+		var keys []string
+		keys, cursor, err = r.Client.Scan(cursor, "authorizations:*:amounts:*:transfers", 1000).Result()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			// authorizations:<account>:amounts:<amount>:transfers
+			parts := strings.Split(key, ":")
+			if len(parts) != 5 {
+				continue
+			}
+			err = r.Client.SAdd(fmt.Sprintf("authorizations:%s:amounts", parts[1]), parts[3]).Err()
+			if err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	return r.Client.Set(authorizationsMigratedRedisKey, 1, 0).Err()
+}
+
+type authorizationKey struct {
+	debitAccountId tbtypes.Uint128
+	amount         uint64
+}
+
+type MemoryAuthorizationStore struct {
+	mu             sync.Mutex
+	authorizations map[authorizationKey][]tbtypes.Uint128
+}
+
+func NewMemoryAuthorizationStore() *MemoryAuthorizationStore {
+	return &MemoryAuthorizationStore{authorizations: map[authorizationKey][]tbtypes.Uint128{}}
+}
+
+func (m *MemoryAuthorizationStore) StoreAuthorization(_ context.Context, debitAccountId tbtypes.Uint128, amount uint64, transferId tbtypes.Uint128) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := authorizationKey{debitAccountId, amount}
+	m.authorizations[key] = append(m.authorizations[key], transferId)
+	return nil
+}
+
+func (m *MemoryAuthorizationStore) GetAuthorizations(_ context.Context, debitAccountId tbtypes.Uint128, minAmount uint64) ([]Authorization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var authorizations []Authorization
+	for key, transfers := range m.authorizations {
+		if key.debitAccountId != debitAccountId || key.amount < minAmount {
+			continue
+		}
+		for _, tid := range transfers {
+			authorizations = append(authorizations, Authorization{TransferId: tid, Amount: key.amount})
+		}
+	}
+	sort.SliceStable(authorizations, func(i, j int) bool { return authorizations[i].Amount < authorizations[j].Amount })
+	return authorizations, nil
+}
+
+func (m *MemoryAuthorizationStore) RemoveAuthorization(_ context.Context, debitAccountId tbtypes.Uint128, amount uint64, transferId tbtypes.Uint128) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := authorizationKey{debitAccountId, amount}
+	var remaining []tbtypes.Uint128
+	for _, tid := range m.authorizations[key] {
+		if tid != transferId {
+			remaining = append(remaining, tid)
+		}
+	}
+	if len(remaining) == 0 {
+		delete(m.authorizations, key)
+	} else {
+		m.authorizations[key] = remaining
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package workflow
+
+import (
+	"context"
+	"encore.dev/storage/sqldb"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+)
+
+// SqlAuthorizationStore keeps authorizations in the service's Postgres
+// database, see app/migrations.
+type SqlAuthorizationStore struct{}
+
+func (SqlAuthorizationStore) StoreAuthorization(ctx context.Context, debitAccountId tbtypes.Uint128, amount uint64, transferId tbtypes.Uint128) error {
+	_, err := sqldb.Exec(ctx, `
+		INSERT INTO authorizations (transfer_id, debit_account_id, amount)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (transfer_id) DO NOTHING
+	`, transferId.String(), debitAccountId.String(), int64(amount))
+	return err
+}
+
+func (SqlAuthorizationStore) GetAuthorizations(ctx context.Context, debitAccountId tbtypes.Uint128, minAmount uint64) ([]Authorization, error) {
+	rows, err := sqldb.Query(ctx, `
+		SELECT transfer_id, amount FROM authorizations
+		WHERE debit_account_id = $1 AND amount >= $2
+		ORDER BY amount, created_at
+	`, debitAccountId.String(), int64(minAmount))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var authorizations []Authorization
+	for rows.Next() {
+		var transfer string
+		var amount int64
+		if err := rows.Scan(&transfer, &amount); err != nil {
+			return nil, err
+		}
+		tid, _ := tbtypes.HexStringToUint128(transfer)
+		authorizations = append(authorizations, Authorization{TransferId: tid, Amount: uint64(amount)})
+	}
+	return authorizations, rows.Err()
+}
+
+func (SqlAuthorizationStore) RemoveAuthorization(ctx context.Context, debitAccountId tbtypes.Uint128, amount uint64, transferId tbtypes.Uint128) error {
+	_, err := sqldb.Exec(ctx, `
+		DELETE FROM authorizations
+		WHERE transfer_id = $1 AND debit_account_id = $2 AND amount = $3
+	`, transferId.String(), debitAccountId.String(), int64(amount))
+	return err
+}
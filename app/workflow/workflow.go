@@ -1,21 +1,63 @@
 package workflow
 
 import (
+	"encore.app/app/ledger"
 	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
 	"log"
+	"math"
+	"math/bits"
 	"time"
 )
 
 const (
-	CreditAccountId           = "1234567"
+	// AuthorizationHoldDuration is the hold duration of authorizations made
+	// without one.
 	AuthorizationHoldDuration = 10 * time.Second
 	InvalidTransferIdString   = "00000000000000000000000000000000"
 )
 
 var InvalidTransferId, _ = tbtypes.HexStringToUint128(InvalidTransferIdString)
 
-func Auth(ctx workflow.Context, accountId tbtypes.Uint128, amount uint64) (tbtypes.Uint128, error) {
+func VoidWorkflowId(transferId tbtypes.Uint128) string {
+	return "void-" + transferId.String()
+}
+
+// newTransferIds generates the IDs of the transfers an activity creates. They
+// are recorded in the workflow history, so they stay the same when the
+// activity is retried and the ledger reports the transfers as existing instead
+// of creating them twice.
+func newTransferIds(ctx workflow.Context) TransferIds {
+	var ids TransferIds
+	encoded := workflow.SideEffect(ctx, func(workflow.Context) interface{} {
+		return TransferIds{Transfer: ledger.NewId(), Hold: ledger.NewId()}
+	})
+	_ = encoded.Get(&ids)
+	return ids
+}
+
+// holdDuration is duration, or AuthorizationHoldDuration if it is not set.
+func holdDuration(duration time.Duration) time.Duration {
+	if duration <= 0 {
+		return AuthorizationHoldDuration
+	}
+	return duration
+}
+
+type AuthOptions struct {
+	// Ledger is the ledger of the account's currency. Authorizations without
+	// one fail.
+	Ledger uint32
+	// CreditAccountId is the account the authorization settles to.
+	CreditAccountId tbtypes.Uint128
+	// HoldDuration is how long the funds are held, see holdDuration.
+	HoldDuration time.Duration
+}
+
+// Auth places a hold of amount on the account.
+func Auth(ctx workflow.Context, accountId tbtypes.Uint128, amount uint64, authOptions AuthOptions) (tbtypes.Uint128, error) {
 	options := workflow.ActivityOptions{
 		StartToCloseTimeout: time.Minute * 5,
 	}
@@ -24,45 +66,149 @@ func Auth(ctx workflow.Context, accountId tbtypes.Uint128, amount uint64) (tbtyp
 
 	var a *Activities
 
-	var accountExistsWithSufficientBalance bool
-	err := workflow.ExecuteActivity(ctx, a.CheckAccountExistsWithSufficientBalance, accountId, amount).Get(ctx, &accountExistsWithSufficientBalance)
+	log.Printf("starting authorization for %d on account %s %s %s", amount, accountId, accountId.String(), authOptions.CreditAccountId.String())
+
+	// The ledger declines holds the account's balance does not cover.
+	var transferId tbtypes.Uint128
+	err := workflow.ExecuteActivity(ctx, a.PlaceAuthorization, newTransferIds(ctx), accountId, amount, authOptions).Get(ctx, &transferId)
 	if err != nil {
-		log.Printf("Could not check account existence: %s", err)
+		log.Printf("Could not place authoriation: %s", err)
 		return InvalidTransferId, err
 	}
-	if !accountExistsWithSufficientBalance {
+	if transferId == InvalidTransferId {
 		log.Printf("Account %s does not exist or doesn't have sufficient balance", accountId)
 		return InvalidTransferId, nil
 	}
 
-	creditAccountIdCasted, _ := tbtypes.HexStringToUint128(CreditAccountId)
-	log.Printf("starting authorization for %d on account %s %s %s", amount, accountId, accountId.String(), creditAccountIdCasted.String())
-
-	var transferId tbtypes.Uint128
-	err = workflow.ExecuteActivity(ctx, a.PlaceAuthorization, accountId, creditAccountIdCasted, amount).Get(ctx, &transferId)
+	err = scheduleExpiry(ctx, accountId, transferId, transferId, authOptions.HoldDuration)
 	if err != nil {
-		log.Printf("Could not place authoriation: %s", err)
+		log.Printf("Could not schedule expiry of pending transfer: %s", err)
 		return InvalidTransferId, err
 	}
 
-	//cwo := workflow.ChildWorkflowOptions{
-	//	WorkflowID:        uuid.New().String(),
-	//	ParentClosePolicy: enums.ParentClosePolicy(3),
-	//}
-	//ctx = workflow.WithChildOptions(ctx, cwo)
-	//workflow.ExecuteChildWorkflow(ctx, Void, transferId, AuthorizationHoldDuration)
-	//err = workflow.ExecuteChildWorkflow(ctx, Void, transferId, AuthorizationHoldDuration).GetChildWorkflowExecution().Get(ctx, nil)
-	//if err != nil {
-	//	log.Printf("Could not void pending transfer: %s", err)
-	//	return false, err
-	//}
-
 	log.Printf("Placed authorization for %d on account %s", amount, accountId)
 
 	return transferId, nil
 }
 
-func Present(ctx workflow.Context, accountId tbtypes.Uint128, amount uint64) (bool, error) {
+// scheduleExpiry starts the Void workflow for a hold. It is abandoned rather
+// than waited on so that it outlives the caller, but the caller only completes
+// once it has been started.
+func scheduleExpiry(ctx workflow.Context, accountId tbtypes.Uint128, authorizationId tbtypes.Uint128, transferId tbtypes.Uint128, holdDuration time.Duration) error {
+	cwo := workflow.ChildWorkflowOptions{
+		WorkflowID:        VoidWorkflowId(transferId),
+		ParentClosePolicy: enums.PARENT_CLOSE_POLICY_ABANDON,
+	}
+	childCtx := workflow.WithChildOptions(ctx, cwo)
+	err := workflow.ExecuteChildWorkflow(childCtx, Void, accountId, authorizationId, transferId, holdDuration).GetChildWorkflowExecution().Get(ctx, nil)
+	if err != nil && !temporal.IsWorkflowExecutionAlreadyStartedError(err) {
+		return err
+	}
+	return nil
+}
+
+type IncrementResult struct {
+	Incremented bool
+	// TransferId is the pending transfer now holding HeldAmount for the
+	// authorization.
+	TransferId tbtypes.Uint128
+	HeldAmount uint64
+}
+
+// Increment raises the amount held for an authorization by amount and restarts
+// its hold duration, see holdDuration.
+func Increment(ctx workflow.Context, accountId tbtypes.Uint128, authorizationId tbtypes.Uint128, transferId tbtypes.Uint128, amount uint64, holdDuration time.Duration) (IncrementResult, error) {
+	options := workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 5,
+	}
+	ctx = workflow.WithActivityOptions(ctx, options)
+	var a *Activities
+
+	var hold Authorization
+	err := workflow.ExecuteActivity(ctx, a.IncrementAuthorization, newTransferIds(ctx), authorizationId, transferId, accountId, amount).Get(ctx, &hold)
+	if err != nil {
+		log.Printf("Could not increment authorization: %s", err)
+		return IncrementResult{}, err
+	}
+	if hold.TransferId == InvalidTransferId {
+		log.Printf("Authorization %s is no longer pending or doesn't have sufficient balance", authorizationId)
+		return IncrementResult{}, nil
+	}
+
+	err = scheduleExpiry(ctx, accountId, authorizationId, hold.TransferId, holdDuration)
+	if err != nil {
+		log.Printf("Could not schedule expiry of pending transfer: %s", err)
+		return IncrementResult{}, err
+	}
+
+	log.Printf("Incremented authorization %s by %d to %d", authorizationId, amount, hold.Amount)
+	return IncrementResult{Incremented: true, TransferId: hold.TransferId, HeldAmount: hold.Amount}, nil
+}
+
+// Reverse releases amount of an authorization's hold, or all of it if amount is
+// zero. A full reversal also cancels the hold's Void workflow.
+func Reverse(ctx workflow.Context, accountId tbtypes.Uint128, authorizationId tbtypes.Uint128, transferId tbtypes.Uint128, expiryId tbtypes.Uint128, amount uint64) (ReverseResult, error) {
+	options := workflow.ActivityOptions{
+		StartToCloseTimeout: time.Minute * 5,
+	}
+	ctx = workflow.WithActivityOptions(ctx, options)
+	var a *Activities
+
+	var result ReverseResult
+	err := workflow.ExecuteActivity(ctx, a.ReverseAuthorization, newTransferIds(ctx), authorizationId, transferId, accountId, amount).Get(ctx, &result)
+	if err != nil {
+		log.Printf("Could not reverse authorization: %s", err)
+		return ReverseResult{}, err
+	}
+	if !result.Reversed {
+		log.Printf("Authorization %s is no longer pending", authorizationId)
+		return result, nil
+	}
+
+	if result.TransferId == InvalidTransferId {
+		err = workflow.RequestCancelExternalWorkflow(ctx, VoidWorkflowId(expiryId), "").Get(ctx, nil)
+		if err != nil {
+			log.Printf("Could not cancel expiry of authorization %s: %s", authorizationId, err)
+		}
+	}
+
+	log.Printf("Reversed %d of authorization %s", result.ReversedAmount, authorizationId)
+	return result, nil
+}
+
+type PresentOptions struct {
+	// Final releases whatever remains of the authorization after the capture.
+	// Otherwise it stays held for later captures.
+	Final bool
+	// AuthorizationId references the authorization to capture, and TransferId
+	// is the pending transfer currently holding its funds. Without a reference
+	// the smallest authorization on the account covering the amount, but no
+	// more than MaxAmount, is captured, except the holds in
+	// ExcludedTransferIds, which are those of other merchants.
+	AuthorizationId     tbtypes.Uint128
+	TransferId          tbtypes.Uint128
+	MaxAmount           uint64
+	ExcludedTransferIds []tbtypes.Uint128
+}
+
+// PresentmentMaxAmount is the largest authorization a presentment of amount
+// without a reference matches, tolerancePercent more than amount, at most the
+// largest amount.
+func PresentmentMaxAmount(amount uint64, tolerancePercent uint64) uint64 {
+	hi, lo := bits.Mul64(amount, tolerancePercent)
+	if hi >= 100 {
+		return math.MaxUint64
+	}
+	tolerance, _ := bits.Div64(hi, lo, 100)
+	maxAmount, carry := bits.Add64(amount, tolerance, 0)
+	if carry != 0 {
+		return math.MaxUint64
+	}
+	return maxAmount
+}
+
+// Present captures amount against an authorization on the account.
+func Present(ctx workflow.Context, accountId tbtypes.Uint128, amount uint64, presentOptions PresentOptions) (PresentResult, error) {
 	//retrypolicy := &temporal.RetryPolicy{
 	//	MaximumAttempts: 1,
 	//}
@@ -78,50 +224,77 @@ func Present(ctx workflow.Context, accountId tbtypes.Uint128, amount uint64) (bo
 	err := workflow.ExecuteActivity(ctx, a.CheckAccountExists, accountId).Get(ctx, &accountExists)
 	if err != nil {
 		log.Printf("Could not check account existence: %s", err)
-		return false, err
+		return PresentResult{}, err
 	}
 	if !accountExists {
 		log.Printf("Account %s does not exist", accountId)
-		return false, nil
+		return PresentResult{}, nil
 	}
 
-	var transferId tbtypes.Uint128
-	err = workflow.ExecuteActivity(ctx, a.MatchPresentment, accountId, amount).Get(ctx, &transferId)
+	if presentOptions.AuthorizationId != InvalidTransferId && presentOptions.TransferId == InvalidTransferId {
+		log.Printf("Authorization %s can not be presented by this merchant", presentOptions.AuthorizationId)
+		return PresentResult{}, nil
+	}
+
+	var authorization Authorization
+	if presentOptions.AuthorizationId != InvalidTransferId {
+		err = workflow.ExecuteActivity(ctx, a.MatchAuthorization, presentOptions.TransferId, accountId, amount).Get(ctx, &authorization)
+	} else {
+		err = workflow.ExecuteActivity(ctx, a.MatchPresentment, accountId, amount, presentOptions.MaxAmount, presentOptions.ExcludedTransferIds).Get(ctx, &authorization)
+	}
 	if err != nil {
 		log.Printf("Error in finding pending auth: %s", err)
-		return false, err
+		return PresentResult{}, err
 	}
 
-	if transferId == InvalidTransferId {
+	if authorization.TransferId == InvalidTransferId {
 		log.Printf("No pending auth found for %d on account %s", amount, accountId)
-		return false, nil
+		return PresentResult{}, nil
 	}
 
-	err = workflow.ExecuteActivity(ctx, a.PostPendingTransfer, transferId, accountId, amount).Get(ctx, nil)
+	var capture CaptureResult
+	err = workflow.ExecuteActivity(ctx, a.PostPendingTransfer, newTransferIds(ctx), authorization, accountId, amount, presentOptions.Final).Get(ctx, &capture)
 	if err != nil {
 		log.Printf("Could not post pending transfer: %s", err)
-		return false, err
+		return PresentResult{}, err
 	}
 
-	log.Printf("Matched placement with presentment for %d on account %s with transfer %s", amount, accountId, transferId)
-	return true, nil
+	log.Printf("Matched placement of %d with presentment for %d on account %s with transfer %s", authorization.Amount, amount, accountId, authorization.TransferId)
+	return PresentResult{Matched: true, TransferId: authorization.TransferId, CaptureResult: capture}, nil
 }
 
-func Void(ctx workflow.Context, transferId tbtypes.Uint128) error {
+// Void expires a hold once its hold duration has elapsed. Holds have no ledger
+// timeout, see newHold, so this is what releases them and cleans up the
+// Account workflow's state. The void itself is
+// handed to the Account workflow so that it is ordered with any presentment
+// for the same hold. transferId is the pending transfer that started the hold
+// duration, the Account workflow ignores the expiry if the authorization has
+// been incremented since.
+func Void(ctx workflow.Context, accountId tbtypes.Uint128, authorizationId tbtypes.Uint128, transferId tbtypes.Uint128, duration time.Duration) error {
 	options := workflow.ActivityOptions{
 		StartToCloseTimeout: time.Minute * 5,
 	}
 	ctx = workflow.WithActivityOptions(ctx, options)
 
-	err := workflow.Sleep(ctx, AuthorizationHoldDuration)
+	err := workflow.Sleep(ctx, holdDuration(duration))
 	if err != nil {
 		return err
 	}
 
+	operation := AccountOperation{Type: OperationExpire, AuthorizationId: authorizationId, TransferId: transferId}
+	err = workflow.SignalExternalWorkflow(ctx, AccountWorkflowId(accountId), "", AccountSignal, operation).Get(ctx, nil)
+	if err == nil {
+		return nil
+	}
+	log.Printf("Could not signal account workflow for %s, voiding directly: %s", accountId, err)
+	return voidIfPending(ctx, transferId)
+}
+
+func voidIfPending(ctx workflow.Context, transferId tbtypes.Uint128) error {
 	var a *Activities
 
 	var isPendingTransfer bool
-	err = workflow.ExecuteActivity(ctx, a.IsPendingTransfer, transferId).Get(ctx, &isPendingTransfer)
+	err := workflow.ExecuteActivity(ctx, a.IsPendingTransfer, transferId).Get(ctx, &isPendingTransfer)
 	if err != nil {
 		log.Printf("Could not check pending transfer: %s", err)
 		return err
@@ -131,7 +304,7 @@ func Void(ctx workflow.Context, transferId tbtypes.Uint128) error {
 		return nil
 	}
 
-	err = workflow.ExecuteActivity(ctx, a.VoidAuthorization, transferId).Get(ctx, nil)
+	err = workflow.ExecuteActivity(ctx, a.VoidAuthorization, newTransferIds(ctx), transferId).Get(ctx, nil)
 	if err != nil {
 		log.Printf("Could not void pending transfer: %s", err)
 		return err
@@ -0,0 +1,47 @@
+package workflow
+
+import (
+	"encore.app/app/ledger"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"math"
+	"testing"
+)
+
+func testId(n uint64) tbtypes.Uint128 {
+	return ledger.NthId(InvalidTransferId, n)
+}
+
+func TestPresentmentMaxAmount(t *testing.T) {
+	tests := []struct {
+		amount           uint64
+		tolerancePercent uint64
+		want             uint64
+	}{
+		{100, 20, 120},
+		{100, 0, 100},
+		{99, 20, 118},
+		{math.MaxUint64 / 2, 20, math.MaxUint64/2 + math.MaxUint64/10},
+		{math.MaxUint64, 0, math.MaxUint64},
+		{math.MaxUint64, 20, math.MaxUint64},
+		{math.MaxUint64 / 2, 150, math.MaxUint64},
+		{1 << 60, math.MaxUint64, math.MaxUint64},
+	}
+	for _, test := range tests {
+		if got := PresentmentMaxAmount(test.amount, test.tolerancePercent); got != test.want {
+			t.Errorf("PresentmentMaxAmount(%d, %d) = %d, want %d", test.amount, test.tolerancePercent, got, test.want)
+		}
+	}
+}
+
+func TestOtherMerchantsHolds(t *testing.T) {
+	holds := map[string]Hold{
+		"c": {TransferId: testId(3), MerchantId: "other"},
+		"a": {TransferId: testId(1), MerchantId: "another"},
+		"b": {TransferId: testId(2), MerchantId: "acme"},
+		"d": {TransferId: testId(4)},
+	}
+	got := otherMerchantsHolds(holds, "acme")
+	if len(got) != 2 || got[0] != testId(1) || got[1] != testId(3) {
+		t.Errorf("got %v, want the holds of other merchants in order", got)
+	}
+}
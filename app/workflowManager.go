@@ -2,69 +2,352 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
+	"encore.app/app/idempotency"
+	"encore.app/app/ledger"
 	"encore.app/app/workflow"
 	encore "encore.dev"
+	"encore.dev/beta/errs"
+	"errors"
 	"fmt"
 	"github.com/go-redis/redis"
-	tb "github.com/tigerbeetledb/tigerbeetle-go"
+	"github.com/google/uuid"
+	tbtypes "github.com/tigerbeetledb/tigerbeetle-go/pkg/types"
+	"go.temporal.io/api/serviceerror"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/worker"
 	"log"
+	"time"
 )
 
 const (
-	LedgerId = 1
+	operationPollInterval = 100 * time.Millisecond
+	// operationTimeout bounds how long a request waits for the result of its
+	// operation, which is queued behind the account's other operations.
+	operationTimeout = time.Minute
 )
 
 var (
 	envName   = encore.Meta().Environment.Name
-	taskQueue = envName + "-task-queue"
+	taskQueue = newTaskQueue()
 )
 
+func newTaskQueue() string {
+	if cfg.Temporal.TaskQueue != "" {
+		return cfg.Temporal.TaskQueue
+	}
+	return envName + "-task-queue"
+}
+
 //encore:service
 type Service struct {
-	temporalClient client.Client
-	temporalWorker worker.Worker
-	redisClient    *redis.Client
-	tbClient       tb.Client
+	temporalClient  client.Client
+	temporalWorker  worker.Worker
+	redisClient     *redis.Client
+	ledger          ledger.Ledger
+	journal         ledger.Journal
+	idempotencyKeys idempotency.Store
+	currencies      *ledger.Currencies
+	rates           RateProvider
+	// merchantAccounts are the settlement accounts of merchants, by merchant
+	// and currency.
+	merchantAccounts map[merchantCurrency]tbtypes.Uint128
 }
 
 func initService() (*Service, error) {
-	c, err := client.Dial(client.Options{})
+	currencies, err := newCurrencies()
+	if err != nil {
+		return nil, fmt.Errorf("load currencies: %v", err)
+	}
+	rates, err := NewStaticRateProvider(cfg.FxRates)
+	if err != nil {
+		return nil, fmt.Errorf("load FX rates: %v", err)
+	}
+	merchantAccounts, err := newMerchantAccounts(currencies)
+	if err != nil {
+		return nil, fmt.Errorf("load merchants: %v", err)
+	}
+
+	temporalOptions, err := newTemporalOptions()
+	if err != nil {
+		return nil, fmt.Errorf("configure temporal client: %v", err)
+	}
+	// The client connects on first use, so that the check can retry it.
+	c, err := client.NewLazyClient(temporalOptions)
 	if err != nil {
 		return nil, fmt.Errorf("create temporal client: %v", err)
 	}
+	err = awaitDependency(dependency{DependencyTemporal, temporalCheck(c)})
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
 
-	redisClient := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-	})
+	redisClient := newRedisClient()
+	closeClients := func() {
+		c.Close()
+		if redisClient != nil {
+			_ = redisClient.Close()
+		}
+	}
+	if redisClient != nil {
+		err = awaitDependency(dependency{DependencyRedis, redisCheck(redisClient)})
+		if err != nil {
+			closeClients()
+			return nil, err
+		}
+	}
 
-	tbClient, err := tb.NewClient(0, []string{"3000"}, 1)
+	l, journal, err := newLedger()
+	if err != nil {
+		closeClients()
+		return nil, fmt.Errorf("create ledger: %v", err)
+	}
+	err = awaitDependency(dependency{DependencyLedger, ledgerCheck(l)})
 	if err != nil {
-		log.Printf("Error creating tbclient: %s", err)
+		closeClients()
+		l.Close()
+		return nil, err
+	}
+
+	authorizations, err := newAuthorizationStore(redisClient)
+	if err != nil {
+		closeClients()
+		l.Close()
+		return nil, fmt.Errorf("migrate authorization store: %v", err)
+	}
+	s := &Service{
+		temporalClient:   c,
+		redisClient:      redisClient,
+		ledger:           l,
+		journal:          journal,
+		idempotencyKeys:  newIdempotencyStore(redisClient),
+		currencies:       currencies,
+		rates:            rates,
+		merchantAccounts: merchantAccounts,
+	}
+	if cfg.BootstrapSystemAccounts {
+		err = s.bootstrapSystemAccounts(context.Background())
+		if err != nil {
+			closeClients()
+			l.Close()
+			return nil, fmt.Errorf("bootstrap system accounts: %v", err)
+		}
 	}
 
 	w := worker.New(c, taskQueue, worker.Options{})
+	w.RegisterWorkflow(workflow.Account)
 	w.RegisterWorkflow(workflow.Auth)
+	w.RegisterWorkflow(workflow.Increment)
+	w.RegisterWorkflow(workflow.Reverse)
 	w.RegisterWorkflow(workflow.Present)
 	w.RegisterWorkflow(workflow.Void)
-	activities := &workflow.Activities{RedisClient: redisClient, TbClient: tbClient}
+	activities := &workflow.Activities{Ledger: l, Authorizations: authorizations}
 	w.RegisterActivity(activities)
 
 	err = w.Start()
 	if err != nil {
-		c.Close()
+		closeClients()
+		l.Close()
 		return nil, fmt.Errorf("start temporal worker: %v", err)
 	}
-	return &Service{temporalClient: c, temporalWorker: w, redisClient: redisClient, tbClient: tbClient}, nil
+	s.temporalWorker = w
+	return s, nil
+}
+
+// signalAccount hands an operation to the account's Account workflow, starting
+// the workflow if it isn't running.
+func (s *Service) signalAccount(ctx context.Context, accountId tbtypes.Uint128, operation workflow.AccountOperation) error {
+	options := client.StartWorkflowOptions{
+		ID:        workflow.AccountWorkflowId(accountId),
+		TaskQueue: taskQueue,
+	}
+	_, err := s.temporalClient.SignalWithStartWorkflow(ctx, options.ID, workflow.AccountSignal, operation, options, workflow.Account, accountId, workflow.AccountState{})
+	if err != nil {
+		return errs.WrapCode(err, errs.Unavailable, "could not reach temporal")
+	}
+	return nil
+}
+
+// requestId is the workflow ID of a signalled operation. Operations made with
+// an idempotency key derive it from their request key, see idempotent, so that
+// Temporal also rejects a duplicate that gets past the idempotency store.
+func requestId(operationType string, requestKey string) string {
+	if requestKey == "" {
+		return uuid.New().String()
+	}
+	return operationType + "-" + requestKey
+}
+
+// parseId parses an account or transfer ID from a request, see ledger.ParseId.
+// name is the parameter it came from.
+func parseId(name string, value string) (tbtypes.Uint128, error) {
+	id, err := ledger.ParseId(value)
+	if err != nil {
+		return workflow.InvalidTransferId, &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("%s %s", name, err)}
+	}
+	return id, nil
+}
+
+// checkAmount fails for amounts larger than ledger.MaxAmount.
+func checkAmount(name string, amount uint64) error {
+	if amount > ledger.MaxAmount {
+		return &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("%s must be at most %d", name, uint64(ledger.MaxAmount))}
+	}
+	return nil
+}
+
+// lookupAuthorization returns the pending transfer that placed an
+// authorization, whose debit account is the authorization's account and
+// ledger its currency, and false if there is no such authorization.
+func (s *Service) lookupAuthorization(authorizationId tbtypes.Uint128) (tbtypes.Transfer, bool, error) {
+	transfers, err := s.ledger.LookupTransfers([]tbtypes.Uint128{authorizationId})
+	if err != nil || len(transfers) == 0 {
+		return tbtypes.Transfer{}, false, err
+	}
+	return transfers[0], true, nil
+}
+
+// awaitOperation waits for the result of a signalled operation. The child
+// workflow running it only exists once the Account workflow gets to it. If it
+// has no result within operationTimeout, the operation may still complete, the
+// request fails with Unavailable and can be retried with its idempotency key.
+func (s *Service) awaitOperation(ctx context.Context, requestId string, valuePtr interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout)
+	defer cancel()
+	for {
+		err := s.temporalClient.GetWorkflow(ctx, requestId, "").Get(ctx, valuePtr)
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			return &errs.Error{Code: errs.Unavailable, Message: "operation did not complete in time"}
+		}
+		var notFound *serviceerror.NotFound
+		if !errors.As(err, &notFound) {
+			return operationError(err)
+		}
+		// Once ctx is done, the next Get fails with its error.
+		select {
+		case <-ctx.Done():
+		case <-time.After(operationPollInterval):
+		}
+	}
+}
+
+// operationError turns the application error of a failed ledger result back
+// into the API error for it, see transferFailure in the workflow package.
+func operationError(err error) error {
+	var applicationErr *temporal.ApplicationError
+	if !errors.As(err, &applicationErr) || !applicationErr.HasDetails() {
+		return err
+	}
+	var code int
+	if applicationErr.Details(&code) != nil {
+		return err
+	}
+	return &errs.Error{
+		Code:    errs.ErrCode(code),
+		Message: applicationErr.Message(),
+		Details: ledger.ResultDetails{Reason: applicationErr.Type()},
+	}
+}
+
+// newTemporalOptions are the options of the Temporal client.
+func newTemporalOptions() (client.Options, error) {
+	options := client.Options{
+		HostPort:  cfg.Temporal.HostPort,
+		Namespace: cfg.Temporal.Namespace,
+	}
+	if !cfg.Temporal.TLS {
+		return options, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	switch {
+	case unused(secrets.TemporalTLSCert) && unused(secrets.TemporalTLSKey):
+		// The server doesn't authenticate clients.
+	case unused(secrets.TemporalTLSCert) || unused(secrets.TemporalTLSKey):
+		return client.Options{}, fmt.Errorf("TemporalTLSCert and TemporalTLSKey must both be set, or both be empty")
+	default:
+		certificate, err := tls.X509KeyPair([]byte(secrets.TemporalTLSCert), []byte(secrets.TemporalTLSKey))
+		if err != nil {
+			return client.Options{}, fmt.Errorf("load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	options.ConnectionOptions = client.ConnectionOptions{TLS: tlsConfig}
+	return options, nil
+}
+
+// holdDuration is how long authorizations hold funds.
+func holdDuration() time.Duration {
+	return time.Duration(cfg.AuthorizationHoldSeconds) * time.Second
+}
+
+// newLedger returns the ledger, which records the transfers created through it
+// in the returned journal. TigerBeetle fails with Unavailable errors while the
+// cluster can't be reached, see ledger.Guarded.
+func newLedger() (ledger.Ledger, ledger.Journal, error) {
+	if cfg.LedgerBackend == ledger.BackendMemory {
+		journal := ledger.NewMemoryJournal()
+		return &ledger.Journaled{Ledger: ledger.NewMemory(), Journal: journal}, journal, nil
+	}
+	tb, err := ledger.NewTigerBeetle(cfg.TigerBeetle.ClusterId, cfg.TigerBeetle.Addresses, cfg.TigerBeetle.Concurrency)
+	if err != nil {
+		return nil, nil, err
+	}
+	l := ledger.NewGuarded(tb, healthTimeout(), cfg.TigerBeetle.Concurrency)
+	return &ledger.Journaled{Ledger: l, Journal: ledger.SqlJournal{}}, ledger.SqlJournal{}, nil
+}
+
+// storedInRedis reports whether a store setting selects Redis, the default.
+func storedInRedis(store string) bool {
+	return store != workflow.AuthorizationStoreMemory && store != workflow.AuthorizationStoreSql
+}
+
+func newRedisClient() *redis.Client {
+	if !storedInRedis(cfg.AuthorizationStore) && !storedInRedis(cfg.IdempotencyStore) {
+		return nil
+	}
+	options := &redis.Options{
+		Addr: cfg.Redis.Addr,
+		DB:   cfg.Redis.DB,
+	}
+	if !unused(secrets.RedisPassword) {
+		options.Password = secrets.RedisPassword
+	}
+	return redis.NewClient(options)
+}
+
+// newAuthorizationStore returns the authorization store, migrating Redis
+// stores written before amounts were indexed.
+func newAuthorizationStore(redisClient *redis.Client) (workflow.AuthorizationStore, error) {
+	switch cfg.AuthorizationStore {
+	case workflow.AuthorizationStoreMemory:
+		return workflow.NewMemoryAuthorizationStore(), nil
+	case workflow.AuthorizationStoreSql:
+		return workflow.SqlAuthorizationStore{}, nil
+	}
+	store := &workflow.RedisAuthorizationStore{Client: redisClient}
+	return store, store.Migrate()
+}
+
+func newIdempotencyStore(redisClient *redis.Client) idempotency.Store {
+	switch cfg.IdempotencyStore {
+	case idempotency.StoreMemory:
+		return idempotency.NewMemoryStore()
+	case idempotency.StoreSql:
+		return idempotency.SqlStore{}
+	}
+	return &idempotency.RedisStore{Client: redisClient}
 }
 
 func (s *Service) Shutdown(force context.Context) {
 	s.temporalClient.Close()
 	s.temporalWorker.Stop()
-	s.tbClient.Close()
-	err := s.redisClient.Close()
-	if err != nil {
-		log.Print("Error in closing redis client: ", err)
+	s.ledger.Close()
+	if s.redisClient != nil {
+		err := s.redisClient.Close()
+		if err != nil {
+			log.Print("Error in closing redis client: ", err)
+		}
 	}
 }